@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// agebases : Timestamps usable with -age-by
+var agebases = []string{"mtime", "atime", "ctime", "btime"}
+
+// fileAge : Timestamp feeding oldest/youngest tracking, chosen with -age-by
+// The modification time is used when the platform or the filesystem does not provide it (second result false)
+func fileAge(ctx *context, path string, file os.FileInfo) (time.Time, bool) {
+	if *ctx.ageby == "mtime" {
+		return file.ModTime(), true
+	}
+	if at, ok := statTime(*ctx.ageby, path, file); ok {
+		return at, true
+	}
+	if !ctx.agewarned {
+		ctx.agewarned = true
+		logError(ctx, fmt.Sprintf("%s not available for %s, mtime used instead\n", *ctx.ageby, path))
+	}
+	return file.ModTime(), false
+}
+
+// ageBasis : Timestamp of a cache, older caches were aged by modification time
+func ageBasis(dirs Directories) string {
+	if dirs.AgeBy == "" {
+		return "mtime"
+	}
+	return dirs.AgeBy
+}
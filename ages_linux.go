@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// statTime : atime and ctime from the stat data, btime with statx (kernel 4.11+, filesystem support needed)
+// Only local files carry the stat data
+func statTime(basis string, path string, info os.FileInfo) (time.Time, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	switch basis {
+	case "atime":
+		return time.Unix(st.Atim.Unix()), true
+	case "ctime":
+		return time.Unix(st.Ctim.Unix()), true
+	case "btime":
+		var stx unix.Statx_t
+		if err := unix.Statx(unix.AT_FDCWD, path, unix.AT_SYMLINK_NOFOLLOW|unix.AT_STATX_DONT_SYNC, unix.STATX_BTIME, &stx); err != nil || stx.Mask&unix.STATX_BTIME == 0 {
+			return time.Time{}, false
+		}
+		return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec)), true
+	}
+	return time.Time{}, false
+}
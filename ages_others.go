@@ -0,0 +1,13 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// statTime : Only modification time is used on other platforms
+func statTime(basis string, path string, info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
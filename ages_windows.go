@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// statTime : Last access and creation times of local files, no change time on Windows
+func statTime(basis string, path string, info os.FileInfo) (time.Time, bool) {
+	d, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}, false
+	}
+	switch basis {
+	case "atime":
+		return time.Unix(0, d.LastAccessTime.Nanoseconds()), true
+	case "btime":
+		return time.Unix(0, d.CreationTime.Nanoseconds()), true
+	}
+	return time.Time{}, false
+}
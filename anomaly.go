@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// anomalyMinHistory : History entries needed before the baseline is trusted
+const anomalyMinHistory = 3
+
+// anomalyFloor : Minimal deviation, relative to the mean, so a flat history does not flag every small change
+const anomalyFloor = 0.1
+
+// Sample : Count and bytes of a directory at one hour of the week (seasonal baseline)
+type Sample struct {
+	At    time.Time
+	Count int
+	Bytes int64
+}
+
+// hourOfWeek : Seasonal slot of a scan time
+func hourOfWeek(t time.Time) int {
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+// trackWeekly : Keep the first sample of this hour for this week and the one of last week
+func (d Directory) trackWeekly() Directory {
+	if d.Weekly == nil {
+		d.Weekly = map[int][]Sample{}
+	}
+	slot := hourOfWeek(d.Current.Scanned)
+	samples := d.Weekly[slot]
+	if len(samples) > 0 && d.Current.Scanned.Sub(samples[len(samples)-1].At) < 24*time.Hour {
+		return d
+	}
+	samples = append(samples, Sample{At: d.Current.Scanned, Count: d.Current.Count, Bytes: d.Current.Bytes})
+	if len(samples) > 2 {
+		samples = samples[len(samples)-2:]
+	}
+	d.Weekly[slot] = samples
+	return d
+}
+
+// lastWeek : Sample taken the same hour one week before the current scan
+func (d Directory) lastWeek() (Sample, bool) {
+	for _, sample := range d.Weekly[hourOfWeek(d.Current.Scanned)] {
+		if age := d.Current.Scanned.Sub(sample.At); age > 6*24*time.Hour && age < 8*24*time.Hour {
+			return sample, true
+		}
+	}
+	return Sample{}, false
+}
+
+// baseline : Moving average and standard deviation of history values
+func baseline(values []float64) (float64, float64) {
+	var sum, squares float64
+	for _, v := range values {
+		sum = sum + v
+	}
+	mean := sum / float64(len(values))
+	for _, v := range values {
+		squares = squares + (v-mean)*(v-mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
+
+// deviation : Distance from the reference in standard deviations, with the floor applied
+func deviation(value float64, reference float64, stddev float64, floor float64) float64 {
+	return (value - reference) / math.Max(stddev, floor)
+}
+
+// detectAnomaly : Compare current count and bytes with the baseline of the histories (-anomaly sigmas)
+// A deviation which was already there the same hour last week is seasonal, not an anomaly
+func detectAnomaly(ctx *context, d Directory) (string, bool) {
+	if *ctx.anomaly <= 0 || len(d.Histories) < anomalyMinHistory {
+		return "", false
+	}
+	counts := make([]float64, 0, len(d.Histories))
+	bytes := make([]float64, 0, len(d.Histories))
+	for _, h := range d.Histories {
+		counts = append(counts, float64(h.Count))
+		bytes = append(bytes, float64(h.Bytes))
+	}
+	week, seasonal := d.lastWeek()
+	reasons := []string{}
+	check := func(name string, value float64, values []float64, last float64, minimum float64, format func(float64) string) {
+		mean, stddev := baseline(values)
+		floor := math.Max(minimum, anomalyFloor*math.Abs(mean))
+		z := deviation(value, mean, stddev, floor)
+		if math.Abs(z) < *ctx.anomaly {
+			return
+		}
+		if seasonal && math.Abs(deviation(value, last, stddev, math.Max(floor, anomalyFloor*math.Abs(last)))) < *ctx.anomaly {
+			return
+		}
+		reasons = append(reasons, fmt.Sprintf("%s %s vs %s±%s %+.1fσ", name, format(value), format(mean), format(stddev), z))
+	}
+	check("count", float64(d.Current.Count), counts, float64(week.Count), 1, func(v float64) string {
+		return fmt.Sprintf("%.0f", v)
+	})
+	check("bytes", float64(d.Current.Bytes), bytes, float64(week.Bytes), 1, func(v float64) string {
+		return humanize.Bytes(uint64(v))
+	})
+	return strings.Join(reasons, ", "), len(reasons) > 0
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBaseline(t *testing.T) {
+	tests := []struct {
+		values []float64
+		mean   float64
+		stddev float64
+	}{
+		{[]float64{5}, 5, 0},
+		{[]float64{10, 10, 10}, 10, 0},
+		{[]float64{2, 4, 4, 4, 5, 5, 7, 9}, 5, 2},
+	}
+	for _, test := range tests {
+		mean, stddev := baseline(test.values)
+		if mean != test.mean || math.Abs(stddev-test.stddev) > 1e-9 {
+			t.Errorf("baseline(%v) = %v, %v want %v, %v", test.values, mean, stddev, test.mean, test.stddev)
+		}
+	}
+}
+
+func TestDeviation(t *testing.T) {
+	tests := []struct {
+		value, reference, stddev, floor float64
+		want                            float64
+	}{
+		{14, 10, 2, 1, 2},
+		{6, 10, 2, 1, -2},
+		{11, 10, 0, 1, 1}, // flat history : the floor is used
+		{12, 10, 0.5, 4, 0.5},
+	}
+	for _, test := range tests {
+		if got := deviation(test.value, test.reference, test.stddev, test.floor); got != test.want {
+			t.Errorf("deviation(%v, %v, %v, %v) = %v want %v", test.value, test.reference, test.stddev, test.floor, got, test.want)
+		}
+	}
+}
+
+func TestDetectAnomaly(t *testing.T) {
+	sigmas := 3.0
+	ctx := &context{anomaly: &sigmas}
+	now := time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)
+	history := func(counts ...int) []Stat {
+		stats := []Stat{}
+		for i, c := range counts {
+			stats = append(stats, Stat{Count: c, Bytes: 1000, Scanned: now.Add(time.Duration(i-len(counts)) * time.Hour)})
+		}
+		return stats
+	}
+	tests := []struct {
+		name    string
+		dir     Directory
+		anomaly bool
+	}{
+		{"not enough history", Directory{Histories: history(10, 10), Current: Stat{Count: 500, Bytes: 1000, Scanned: now}}, false},
+		{"within the baseline", Directory{Histories: history(10, 12, 11, 9), Current: Stat{Count: 12, Bytes: 1000, Scanned: now}}, false},
+		{"count burst", Directory{Histories: history(10, 12, 11, 9), Current: Stat{Count: 60, Bytes: 1000, Scanned: now}}, true},
+		{"same burst last week is seasonal", Directory{Histories: history(10, 12, 11, 9), Current: Stat{Count: 60, Bytes: 1000, Scanned: now},
+			Weekly: map[int][]Sample{hourOfWeek(now): {{At: now.Add(-7 * 24 * time.Hour), Count: 58, Bytes: 1000}}}}, false},
+	}
+	for _, test := range tests {
+		reason, anomaly := detectAnomaly(ctx, test.dir)
+		if anomaly != test.anomaly {
+			t.Errorf("%s: anomaly %v (%s) want %v", test.name, anomaly, reason, test.anomaly)
+		}
+	}
+}
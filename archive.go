@@ -0,0 +1,221 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	backends["zip"] = openArchive
+	backends["tar"] = openArchive
+}
+
+// memInfo : os.FileInfo of an archive entry (or of an implicit archive directory)
+type memInfo struct {
+	name  string
+	size  int64
+	mode  os.FileMode
+	mtime time.Time
+}
+
+func (m memInfo) Name() string       { return m.name }
+func (m memInfo) Size() int64        { return m.size }
+func (m memInfo) Mode() os.FileMode  { return m.mode }
+func (m memInfo) ModTime() time.Time { return m.mtime }
+func (m memInfo) IsDir() bool        { return m.mode.IsDir() }
+func (m memInfo) Sys() interface{}   { return nil }
+
+// memFS : Read only tree built from a list of entries, "/" separated and rooted at "/"
+type memFS struct {
+	prefix  string
+	entries map[string]os.FileInfo
+	dirs    map[string][]os.FileInfo
+}
+
+func newMemFS(prefix string) *memFS {
+	m := &memFS{prefix: prefix, entries: map[string]os.FileInfo{}, dirs: map[string][]os.FileInfo{}}
+	m.entries["/"] = memInfo{name: "/", mode: os.ModeDir | 0555}
+	return m
+}
+
+// add : Register an entry and its missing parent directories
+func (m *memFS) add(name string, info memInfo) {
+	name = path.Clean("/" + name)
+	if _, ok := m.entries[name]; ok || name == "/" {
+		return
+	}
+	parent := path.Dir(name)
+	m.add(parent, memInfo{name: path.Base(parent), mode: os.ModeDir | 0555, mtime: info.mtime})
+	info.name = path.Base(name)
+	m.entries[name] = info
+	m.dirs[parent] = append(m.dirs[parent], info)
+}
+
+func (m *memFS) clean(name string) string {
+	return path.Clean("/" + strings.Replace(name, "\\", "/", -1))
+}
+
+func (m *memFS) ReadDir(name string) ([]os.FileInfo, error) {
+	name = m.clean(name)
+	info, ok := m.entries[name]
+	if !ok || !info.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: m.prefix + name, Err: os.ErrNotExist}
+	}
+	files := append([]os.FileInfo{}, m.dirs[name]...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	return files, nil
+}
+
+func (m *memFS) Stat(name string) (os.FileInfo, error) {
+	if info, ok := m.entries[m.clean(name)]; ok {
+		return info, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: m.prefix + name, Err: os.ErrNotExist}
+}
+
+func (m *memFS) Separator() string {
+	return "/"
+}
+
+func (m *memFS) Prefix() string {
+	return m.prefix
+}
+
+// openArchive : zip://<archive file>!/<path inside> or tar://<archive file>!/<path inside>
+// tar archives may be gzip compressed (.tar.gz, .tgz)
+func openArchive(ctx *context, location string) (FileSystem, string, error) {
+	archive, inner := location, "/"
+	if i := strings.LastIndex(location, "!"); i >= 0 {
+		archive, inner = location[:i], location[i+1:]
+	}
+	if inner == "" {
+		inner = "/"
+	}
+	fsys, err := mountFS(ctx, "archive://"+archive, func() (FileSystem, error) {
+		return readArchive(archive)
+	})
+	return fsys, inner, err
+}
+
+func isZip(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".zip")
+}
+
+func isTar(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasSuffix(lower, ".tar") || strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")
+}
+
+// isArchive : Archive formats bboard is able to open
+func isArchive(name string) bool {
+	return isZip(name) || isTar(name)
+}
+
+// readArchive : Read the entries of a local zip or tar archive
+func readArchive(archive string) (*memFS, error) {
+	if isZip(archive) {
+		return readZip(archive, "zip://"+archive+"!")
+	}
+	return readTar(archive, "tar://"+archive+"!")
+}
+
+// registerArchive : Add an archive and its file entries (directories are skipped)
+// Entries times are kept apart from the files times, the archive itself is still registered as a file
+func (s Stat) registerArchive(file os.FileInfo, entries *memFS) Stat {
+	s.Archives++
+	s.ArchiveBytes = s.ArchiveBytes + file.Size()
+	for _, entry := range entries.entries {
+		if entry.IsDir() {
+			continue
+		}
+		if s.Entries == 0 || entry.ModTime().Before(s.EntryOldest) {
+			s.EntryOldest = entry.ModTime()
+		}
+		if s.Entries == 0 || entry.ModTime().After(s.EntryNewest) {
+			s.EntryNewest = entry.ModTime()
+		}
+		s.Entries++
+		s.EntryBytes = s.EntryBytes + entry.Size()
+	}
+	return s
+}
+
+// entryOldestAge, entryNewestAge : Ages of the archived files at scan time
+func (s Stat) entryOldestAge() time.Duration {
+	if s.Entries == 0 {
+		return 0
+	}
+	return s.Scanned.Sub(s.EntryOldest)
+}
+
+func (s Stat) entryNewestAge() time.Duration {
+	if s.Entries == 0 {
+		return 0
+	}
+	return s.Scanned.Sub(s.EntryNewest)
+}
+
+// ratio : Compression ratio of the archives (uncompressed / archive size)
+func (s Stat) ratio() float64 {
+	if s.ArchiveBytes == 0 {
+		return 0
+	}
+	return float64(s.EntryBytes) / float64(s.ArchiveBytes)
+}
+
+func readZip(archive string, prefix string) (*memFS, error) {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	m := newMemFS(prefix)
+	for _, file := range reader.File {
+		m.add(file.Name, memInfo{size: int64(file.UncompressedSize64), mode: file.Mode(), mtime: file.Modified})
+	}
+	return m, nil
+}
+
+// tarReader : Open a tar archive, gunzip it when compressed
+func tarReader(archive string) (*tar.Reader, io.Closer, error) {
+	file, err := os.Open(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	lower := strings.ToLower(archive)
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return tar.NewReader(gz), file, nil
+	}
+	return tar.NewReader(file), file, nil
+}
+
+func readTar(archive string, prefix string) (*memFS, error) {
+	reader, closer, err := tarReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	m := newMemFS(prefix)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return m, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.add(header.Name, memInfo{size: header.Size, mode: header.FileInfo().Mode(), mtime: header.ModTime})
+	}
+}
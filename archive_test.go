@@ -0,0 +1,159 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// archived : Entries of the test archives, a directory entry ends with /
+var archived = []struct {
+	name string
+	size int
+}{{"in/", 0}, {"in/a.csv", 10}, {"in/sub/b.csv", 20}, {"in/empty/", 0}, {"out.txt", 5}}
+
+var archivedTime = time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC)
+
+func writeZip(t *testing.T, path string) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := zip.NewWriter(file)
+	for _, entry := range archived {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: archivedTime}
+		if entry.name[len(entry.name)-1] == '/' {
+			header.SetMode(os.ModeDir | 0755)
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(make([]byte, entry.size))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTar(t *testing.T, path string, compressed bool) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var out io.Writer = file
+	if compressed {
+		gz := gzip.NewWriter(file)
+		defer gz.Close()
+		out = gz
+	}
+	w := tar.NewWriter(out)
+	for _, entry := range archived {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(entry.size), ModTime: archivedTime, Typeflag: tar.TypeReg}
+		if entry.name[len(entry.name)-1] == '/' {
+			header.Typeflag, header.Mode = tar.TypeDir, 0755
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(make([]byte, entry.size))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadArchive(t *testing.T) {
+	dir := t.TempDir()
+	archives := map[string]func(string){
+		"files.zip":    func(path string) { writeZip(t, path) },
+		"files.tar":    func(path string) { writeTar(t, path, false) },
+		"files.tar.gz": func(path string) { writeTar(t, path, true) },
+		"files.tgz":    func(path string) { writeTar(t, path, true) },
+	}
+	for name, write := range archives {
+		path := filepath.Join(dir, name)
+		write(path)
+		m, err := readArchive(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		files, err := m.ReadDir("/in")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(files) != 3 || files[0].Name() != "a.csv" || files[0].Size() != 10 || !files[0].ModTime().Equal(archivedTime) ||
+			files[1].Name() != "empty" || !files[1].IsDir() || files[2].Name() != "sub" || !files[2].IsDir() {
+			t.Errorf("%s: /in %v", name, files)
+		}
+		// Implicit directory, only known from its files
+		if info, err := m.Stat("in/sub/"); err != nil || !info.IsDir() || info.Name() != "sub" {
+			t.Errorf("%s: Stat of an implicit directory %v %v", name, info, err)
+		}
+		if _, err := m.ReadDir("/in/a.csv"); err == nil {
+			t.Errorf("%s: ReadDir of a file succeeded", name)
+		}
+		if _, err := m.Stat("/missing"); !os.IsNotExist(err) {
+			t.Errorf("%s: Stat of a missing entry %v", name, err)
+		}
+	}
+
+	broken := filepath.Join(dir, "broken.zip")
+	ioutil.WriteFile(broken, []byte("not a zip"), 0644)
+	if _, err := readArchive(broken); err == nil {
+		t.Errorf("broken archive read")
+	}
+}
+
+// zip://archive!/path sources are counted like local directories
+func TestArchiveSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "files.zip")
+	writeZip(t, path)
+	ctx := testContext("scan")
+	initDataArea(ctx)
+	fsys, inner, err := openSource(ctx, "zip://"+path+"!/in/sub/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inner != "/in/sub/" || fsys.Prefix() != "zip://"+path+"!" || fsys.Separator() != "/" {
+		t.Errorf("source %s %q", fsys.Prefix(), inner)
+	}
+	if again, _, _ := openSource(ctx, "zip://"+path+"!/in/"); again != fsys {
+		t.Errorf("archive read again for the same run")
+	}
+	if err := getFiles(ctx, fsys, "/in/*.csv"); err != nil {
+		t.Fatal(err)
+	}
+	d := ctx.dirfilesout.Directories["zip://"+path+"!/in/*.csv"]
+	if d.Current.Count != 1 || d.Current.Bytes != 10 || d.Base != "zip://"+path+"!/in/" {
+		t.Errorf("wildcard spec in the archive: %+v", d)
+	}
+	if _, _, err := openSource(ctx, "tar://"+filepath.Join(filepath.Dir(path), "missing.tar")+"!/"); err == nil {
+		t.Errorf("missing archive opened")
+	}
+}
+
+// tree -archives counts the entries of the archives found
+func TestRegisterArchive(t *testing.T) {
+	dir := t.TempDir()
+	writeZip(t, filepath.Join(dir, "files.zip"))
+	ioutil.WriteFile(filepath.Join(dir, "notes.txt"), make([]byte, 7), 0644)
+	ctx := testContext("tree", "-archives")
+	stat, _ := walkincremental(ctx, localFS{}, dir, nil)
+	info, _ := os.Stat(filepath.Join(dir, "files.zip"))
+	if stat.Count != 2 || stat.Archives != 1 || stat.ArchiveBytes != info.Size() || stat.Entries != 3 || stat.EntryBytes != 35 ||
+		!stat.EntryOldest.Equal(archivedTime) || !stat.EntryNewest.Equal(archivedTime) {
+		t.Errorf("archives %+v", stat)
+	}
+	if stat.ratio() != float64(35)/float64(info.Size()) {
+		t.Errorf("ratio %v", stat.ratio())
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
@@ -21,6 +23,9 @@ type detail int
 const max_history = 10
 const p_debug = false
 
+// exit : os.Exit on a failed write during the processing, the tui restores the terminal first
+var exit = os.Exit
+
 const (
 	Shortest = iota
 	Longest
@@ -67,14 +72,39 @@ type (
 
 	Stat struct {
 		Count     int
+		Bytes     int64
+		DiskBytes int64
 		LessBytes int64
 		MoreBytes int64
-		LessSecs  time.Duration
-		MoreSecs  time.Duration
-		LbFile    string
-		MbFile    string
-		LsFile    string
-		MsFile    string
+		// Scan reference time and absolute file times, ages are derived at display time
+		Scanned time.Time
+		Oldest  time.Time
+		Newest  time.Time
+		LbFile  string
+		MbFile  string
+		LsFile  string
+		MsFile  string
+		// Ages stored by caches before 2.9, only read to migrate them (see migrate)
+		LessSecs time.Duration `json:",omitempty"`
+		MoreSecs time.Duration `json:",omitempty"`
+		// Tree mode with -archives : zip/tar files found and their entries
+		Archives     int   `json:",omitempty"`
+		ArchiveBytes int64 `json:",omitempty"`
+		Entries      int   `json:",omitempty"`
+		EntryBytes   int64 `json:",omitempty"`
+		EntryOldest  time.Time
+		EntryNewest  time.Time
+		// -owners : breakdown by owner and group (Linux), permission flags
+		Owners        map[string]Usage `json:",omitempty"`
+		Groups        map[string]Usage `json:",omitempty"`
+		WorldWritable int              `json:",omitempty"`
+		Unreadable    int              `json:",omitempty"`
+		// -age-by : files aged by modification time, the basis was not available
+		AgeFallback int `json:",omitempty"`
+		// -stats : mean, median and percentiles of file sizes (bytes) and ages (seconds)
+		Sizes  *Summary  `json:",omitempty"`
+		Ages   *Summary  `json:",omitempty"`
+		sketch *sketches // during the walk only
 	}
 
 	Directory struct {
@@ -82,11 +112,26 @@ type (
 		Path      string
 		Current   Stat
 		Histories []Stat
+		Class     string
+		Previous  string
+		Runs      int
+		Alerts    map[string]string  `json:",omitempty"`
+		Error     string             `json:",omitempty"`
+		Weekly    map[int][]Sample   `json:",omitempty"` // -anomaly seasonal baseline, by hour of week
+		Forecast  *Forecast          `json:",omitempty"` // -config Quotas - soonest projected limit
+		Subdirs   map[string]TreeDir `json:",omitempty"` // tree -incremental - files of each subdirectory
+		Pattern   string             `json:",omitempty"` // Wildcard spec - files of Base matching this name
 	}
 
 	Directories struct {
 		Src         string
+		AgeBy       string
 		Directories map[string]Directory
+		Forecasts   []Forecast           `json:",omitempty"` // -config Quotas with Total
+		Volumes     map[string]Volume    `json:",omitempty"` // Filesystem usage, by base (local Linux)
+		FullScan    *time.Time           `json:",omitempty"` // tree -incremental - last walk reading every directory
+		Groups      map[string]Directory `json:",omitempty"` // -config Groups - aggregated directories, by name
+		Order       []string             `json:",omitempty"` // -sort/-limit - reported directories, in report order
 	}
 
 	context struct {
@@ -98,22 +143,54 @@ type (
 		details       *string
 		errors        *string
 		influxdb      *string
+		check         *bool
+		warning       *int
+		critical      *int
+		configfile    *string
+		config        Config
+		listen        *string
+		interval      *time.Duration
+		command       string
+		filesystems   map[string]FileSystem
+		mounterrors   map[string]error
 		flagNoColor   *bool
 		replay        *bool
 		flagtree      *bool
+		diskusage     *bool
+		archives      *bool
+		workers       *int
+		all           *bool
+		caches        []string // diff - compared quickrefresh caches, old then new
+		owners        *bool
+		ageby         *string
+		stats         *bool
+		anomaly       *float64
+		agewarned     bool
 		selectfile    *string
 		feedback      *int
 		history       *int
 		filecount     uint64
 		dircount      uint64
 		fileprocessed uint64
-		allfilesout   []os.FileInfo
 		dirfilesout   Directories
 		detailsout    *os.File
 		errorsout     *os.File
 		starttime     time.Time
 		endtime       time.Time
 		processlist   bool
+		watch         *bool
+		incremental   *time.Duration
+		nested        *string
+		reuse         bool // tree -incremental - unchanged subdirectories are taken from the cache
+		sortby        *string
+		limit         *int
+		treedetails   map[string]string    // tree details lines, by directory, written in the report order
+		report        []reportEntry        // last report, classified and sorted (tui)
+		watcher       *watcher             // serve -watch - inotify file lists of the cached directories
+		previous      map[string]Directory // tree command - cached directories, for their histories
+		notified      Directories          // scan - notified rules of the previous cache, by directory and group
+		checks        []checkResult
+		trees         map[string]map[string]TreeDir // tree mode - subdirectories of each walked directory (-nested, tui, -incremental)
 	}
 )
 
@@ -121,10 +198,45 @@ type (
 var contexte context
 
 func (s Stat) dumpDetails() {
+	for _, line := range s.details() {
+		fmt.Printf("\t%s\n", line)
+	}
+}
+
+// details : Verbose lines of a stat - oldest, newest, smallest and largest files, usage, stats, owners, archives
+func (s Stat) details() []string {
+	var lines []string
 	if s.Count > 0 {
-		fmt.Printf("\tOldest:(%s-%s)\n\tNewest:(%s-%s)\n\tSmallest:(%s-%s)\n\tLargest:(%s-%s)\n",
-			s.LsFile, humanizeMinutes(int(s.MoreSecs.Minutes())), s.MsFile, humanizeMinutes(int(s.LessSecs.Minutes())), s.LbFile, humanize.Bytes(uint64(s.LessBytes)), s.MbFile, humanize.Bytes(uint64(s.MoreBytes)))
+		lines = append(lines, fmt.Sprintf("Oldest:(%s-%s)", s.MsFile, humanizeMinutes(int(s.oldestAge().Minutes()))),
+			fmt.Sprintf("Newest:(%s-%s)", s.LsFile, humanizeMinutes(int(s.newestAge().Minutes()))),
+			fmt.Sprintf("Smallest:(%s-%s)", s.LbFile, humanize.Bytes(uint64(s.LessBytes))),
+			fmt.Sprintf("Largest:(%s-%s)", s.MbFile, humanize.Bytes(uint64(s.MoreBytes))))
+		if s.DiskBytes > 0 {
+			lines = append(lines, fmt.Sprintf("Usage:(%s apparent-%s on disk)", humanize.Bytes(uint64(s.Bytes)), humanize.Bytes(uint64(s.DiskBytes))))
+		}
+		if s.Sizes != nil {
+			lines = append(lines, fmt.Sprintf("Sizes:(mean %s-median %s-p90 %s-p99 %s)",
+				humanize.Bytes(uint64(s.Sizes.Mean)), humanize.Bytes(uint64(s.Sizes.Median)), humanize.Bytes(uint64(s.Sizes.P90)), humanize.Bytes(uint64(s.Sizes.P99))))
+		}
+		if s.Ages != nil {
+			lines = append(lines, fmt.Sprintf("Ages:(mean %s-median %s-p90 %s-p99 %s)",
+				humanizeMinutes(int(s.Ages.Mean/60)), humanizeMinutes(int(s.Ages.Median/60)), humanizeMinutes(int(s.Ages.P90/60)), humanizeMinutes(int(s.Ages.P99/60))))
+		}
+		if s.AgeFallback > 0 {
+			lines = append(lines, fmt.Sprintf("AgeFallback:(%d files aged by mtime)", s.AgeFallback))
+		}
+		if len(s.Owners) > 0 {
+			lines = append(lines, fmt.Sprintf("Owners:(%s)", formatUsages(s.Owners, true)), fmt.Sprintf("Groups:(%s)", formatUsages(s.Groups, true)))
+		}
+		if s.WorldWritable > 0 || s.Unreadable > 0 {
+			lines = append(lines, fmt.Sprintf("Permissions:(%d world-writable-%d unreadable)", s.WorldWritable, s.Unreadable))
+		}
+		if s.Archives > 0 {
+			lines = append(lines, fmt.Sprintf("Archives:(%d-%d entries-%s uncompressed-ratio %.1f)", s.Archives, s.Entries, humanize.Bytes(uint64(s.EntryBytes)), s.ratio()),
+				fmt.Sprintf("Entries:(oldest %s-newest %s)", humanizeMinutes(int(s.entryOldestAge().Minutes())), humanizeMinutes(int(s.entryNewestAge().Minutes()))))
+		}
 	}
+	return lines
 }
 
 func humanizeUnit(value int, base int, singular string) string {
@@ -154,10 +266,14 @@ func humanizeMinutes(min int) string {
 	return "less than a minute"
 }
 
-func (s Stat) registerFile(file os.FileInfo) Stat {
+func (s Stat) registerFile(file os.FileInfo, at time.Time) Stat {
 	if !file.IsDir() {
+		s = s.registerTime(file, at)
 		s.Count++
-		delay := time.Since(file.ModTime())
+		s.Bytes = s.Bytes + file.Size()
+		if s.sketch != nil {
+			s.sketch.add(file.Size(), s.Scanned.Sub(at))
+		}
 		if file.Size() > s.MoreBytes {
 			s.MoreBytes = file.Size()
 			s.MbFile = file.Name()
@@ -166,109 +282,246 @@ func (s Stat) registerFile(file os.FileInfo) Stat {
 			s.LessBytes = file.Size()
 			s.LbFile = file.Name()
 		}
-		if delay > s.MoreSecs {
-			s.MoreSecs = delay
-			s.MsFile = file.Name()
-		}
-		if delay < s.LessSecs {
-			s.LessSecs = delay
-			s.LsFile = file.Name()
-		}
 	}
 	return s
 }
 
-func (s Stat) registerDir(file os.FileInfo) Stat {
+func (s Stat) registerDir(file os.FileInfo, at time.Time) Stat {
 	if !file.IsDir() {
+		s = s.registerTime(file, at)
 		s.Count++
-		delay := time.Since(file.ModTime())
+		s.Bytes = s.Bytes + file.Size()
+		if s.sketch != nil {
+			s.sketch.add(file.Size(), s.Scanned.Sub(at))
+		}
 		s.MoreBytes = s.MoreBytes + file.Size()
 		s.LessBytes = s.LessBytes + file.Size()
-		if delay > s.MoreSecs {
-			s.MoreSecs = delay
-			s.MsFile = file.Name()
-		}
-		if delay < s.LessSecs {
-			s.LessSecs = delay
-			s.LsFile = file.Name()
-		}
 	}
 	return s
 }
 
+// registerTime : Keep oldest and newest file times, before the file is counted
+func (s Stat) registerTime(file os.FileInfo, at time.Time) Stat {
+	if s.Count == 0 || at.Before(s.Oldest) {
+		s.Oldest = at
+		s.MsFile = file.Name()
+	}
+	if s.Count == 0 || at.After(s.Newest) {
+		s.Newest = at
+		s.LsFile = file.Name()
+	}
+	return s
+}
+
+// oldestAge : Age of the oldest file at scan time, 0 for an empty directory
+func (s Stat) oldestAge() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Scanned.Sub(s.Oldest)
+}
+
+// newestAge : Age of the newest file at scan time, 0 for an empty directory
+func (s Stat) newestAge() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Scanned.Sub(s.Newest)
+}
+
+// migrate : Caches before 2.9 store ages computed during the walk instead of file times
+// Their scan time is unknown, the cache file time is used as reference for current and histories
+func (s Stat) migrate(reference time.Time) Stat {
+	if !s.Scanned.IsZero() {
+		return s
+	}
+	s.Scanned = reference
+	if s.Count > 0 {
+		s.Oldest = reference.Add(-s.MoreSecs)
+		s.Newest = reference.Add(-s.LessSecs)
+	}
+	s.MoreSecs, s.LessSecs = 0, 0
+	return s
+}
+
+// logError : Write error into -errors file, or on console
+func logError(ctx *context, msg string) {
+	if *ctx.errors != "" {
+		if _, err := io.WriteString(ctx.errorsout, msg); err != nil {
+			fmt.Printf("unable to log error: %s", msg)
+			exit(1)
+		}
+		return
+	}
+	fmt.Fprint(consoleOut(ctx), msg)
+}
+
 // Check if path contains Wildcard characters
 func isWildcard(value string) bool {
 	return strings.Contains(value, "*") || strings.Contains(value, "?")
 }
 
-// Get the files' list to copy
-func getFiles(ctx *context, src string) error {
-	pattern := filepath.Base(src)
-	files, err := ioutil.ReadDir(filepath.Dir(src))
+// splitPattern : Directory and file name pattern of a wildcard (or single file) spec
+func splitPattern(fsys FileSystem, src string) (string, string) {
+	if i := strings.LastIndex(src, fsys.Separator()); i >= 0 {
+		return src[:i+1], src[i+1:]
+	}
+	return ".", src
+}
+
+// matchPattern : Case insensitive file name match, an empty pattern matches every file
+func matchPattern(pattern string, name string) bool {
+	match, _ := filepath.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return pattern == "" || match
+}
+
+// countFile : Register a file in the stat of its reported directory, with its details line
+func countFile(ctx *context, fsys FileSystem, reported string, path string, file os.FileInfo, stat Stat) Stat {
+	at, exact := fileAge(ctx, path, file)
+	mode := ""
+	if *ctx.ageby != "mtime" {
+		mode = fmt.Sprintf("\t%v", at)
+	}
+	if *ctx.owners {
+		mode = mode + fileMode(file)
+	}
+	if *ctx.details != "" {
+		if _, err := io.WriteString(ctx.detailsout, fmt.Sprintf("%s\t%s\t%v\t%d%s\n", reported, file.Name(), file.ModTime(), file.Size(), mode)); err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	}
+	if !exact {
+		stat.AgeFallback++
+	}
+	stat = stat.registerFile(file, at)
+	if *ctx.owners {
+		stat = stat.registerOwner(fsys, path, file)
+	}
+	return stat
+}
+
+// getFiles : Count the files matching a wildcard (or single file) spec into one directory, keyed by the spec
+// The directory is listed by batches when possible, only its stat is kept in memory
+func getFiles(ctx *context, fsys FileSystem, src string) error {
+	dirname, pattern := splitPattern(fsys, src)
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return err
+	}
+	prefix := fsys.Prefix()
+	curr := Stat{Count: 0, Scanned: ctx.starttime, MoreBytes: math.MinInt64, LessBytes: math.MaxInt64}
+	if *ctx.stats {
+		curr.sketch = newSketches()
+	}
+	ctx.dircount++
+	err := eachFile(fsys, dirname, func(file os.FileInfo) error {
+		if file.IsDir() || !matchPattern(pattern, file.Name()) {
+			return nil
+		}
+		ctx.filecount++
+		curr = countFile(ctx, fsys, prefix+src, joinPath(fsys, dirname, file.Name()), file, curr)
+		if uint64(*ctx.feedback) > 0 && ctx.filecount%uint64(*ctx.feedback) == 0 {
+			fmt.Printf("f/d(%d/%d)\r", ctx.filecount, ctx.dircount)
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	for _, file := range files {
-		if res, err := filepath.Match(strings.ToLower(pattern), strings.ToLower(file.Name())); res {
-			if err != nil {
-				return err
+	ctx.dirfilesout.Directories[prefix+src] = carryHistory(ctx, Directory{Base: prefix + dirname, Path: prefix + src, Pattern: pattern, Histories: make([]Stat, 0, 10), Current: curr})
+	return nil
+}
+
+// registerEntry : Count one file of a walked tree - disk usage, archives, owners and age
+// With -diskusage, allocated size is summed too and hard linked files are counted once among seen
+// With -archives, entries of local zip/tar files are counted too (see registerArchive)
+func (s Stat) registerEntry(ctx *context, fsys FileSystem, seen map[fileID]bool, path string, info os.FileInfo) Stat {
+	ctx.filecount++
+	if *ctx.diskusage {
+		id, allocated, linked := fileUsage(info)
+		if linked {
+			if seen[id] {
+				return s
 			}
-			ctx.filecount++
-			ctx.allfilesout = append(ctx.allfilesout, file)
-			if *ctx.verbose {
-				if len(ctx.allfilesout) > 300 {
-					fmt.Printf("Append reach 300 limit and more : %d", len(ctx.allfilesout))
-				}
+			seen[id] = true
+		}
+		s.DiskBytes = s.DiskBytes + allocated
+	}
+	if *ctx.archives && isArchive(info.Name()) {
+		if _, local := fsys.(localFS); local {
+			entries, err := readArchive(path)
+			if err != nil {
+				logError(ctx, fmt.Sprintf("unable to open archive %s: %v\n", path, err))
+			} else {
+				s = s.registerArchive(info, entries)
 			}
-			// fmt.Printf("prise en compte de %s", file.Name())
 		}
 	}
-	return nil
+	if *ctx.owners {
+		s = s.registerOwner(fsys, path, info)
+	}
+	at, exact := fileAge(ctx, path, info)
+	if !exact {
+		s.AgeFallback++
+	}
+	return s.registerDir(info, at)
 }
 
 // Walk on Tree to calculate size and get oldest and youngest file
-func walkontree(ctx *context, base string) (stat Stat) {
-	stat = Stat{Count: 0, MoreSecs: math.MinInt64, LessSecs: math.MaxInt64, MoreBytes: int64(0), LessBytes: int64(0)}
-	err := filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+func walkontree(ctx *context, fsys FileSystem, base string) (stat Stat) {
+	stat = Stat{Count: 0, Scanned: ctx.starttime, MoreBytes: int64(0), LessBytes: int64(0)}
+	if *ctx.stats {
+		stat.sketch = newSketches()
+	}
+	seen := map[fileID]bool{}
+	err := walk(fsys, base, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			if *ctx.errors != "" {
 				if _, err := io.WriteString(ctx.errorsout, fmt.Sprintf("prevent panic by handling failure accessing a path %q: %s - %v\n", base, path, err)); err != nil {
 					fmt.Printf("unable to log error on %q: %s, %v\n", base, path, err)
-					os.Exit(1)
+					exit(1)
 				}
 				return err
 			}
-			fmt.Printf("Error %q: %s, %v\n", base, path, err)
+			fmt.Fprintf(consoleOut(ctx), "Error %q: %s, %v\n", base, path, err)
 			return err
 		}
-		stat = stat.registerDir(info)
+		if info.IsDir() {
+			if path != base {
+				ctx.dircount++
+			}
+			return nil
+		}
+		stat = stat.registerEntry(ctx, fsys, seen, path, info)
 		return nil
 	})
 
 	if err != nil {
-		fmt.Printf("error walking the path %q: %v\n", base, err)
+		fmt.Fprintf(consoleOut(ctx), "error walking the path %q: %v\n", base, err)
 	}
 
 	return stat
 }
 
 // Get the files' list to copy
-func getFilesInPath(ctx *context, base string, lookingfor string) error {
+func getFilesInPath(ctx *context, fsys FileSystem, base string, lookingfor string) error {
 	look := strings.Split(lookingfor, ";")
 	exclude := strings.Split(*ctx.exclude, ";")
+	sep := fsys.Separator()
+	prefix := fsys.Prefix()
 	// var filecount uint64 = 0
 	// var dircount uint64 = 0
 	couldprocess := false
-	err := filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+	err := walk(fsys, base, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			if *ctx.errors != "" {
 				if _, err := io.WriteString(ctx.errorsout, fmt.Sprintf("prevent panic by handling failure accessing a path %q: %s - %v\n", base, path, err)); err != nil {
 					fmt.Printf("unable to log error on %q: %s, %v\n", base, path, err)
-					os.Exit(1)
+					exit(1)
 				}
 				return filepath.SkipDir
 			}
-			fmt.Printf("Error %q: %s, %v\n", base, path, err)
+			fmt.Fprintf(consoleOut(ctx), "Error %q: %s, %v\n", base, path, err)
 			return err
 		}
 		if uint64(*ctx.feedback) > 0 && ctx.filecount%uint64(*ctx.feedback) == 0 {
@@ -286,107 +539,301 @@ func getFilesInPath(ctx *context, base string, lookingfor string) error {
 			}
 			couldprocess = false
 			for i := 0; i < len(look); i++ {
-				couldprocess = couldprocess || strings.ToLower(info.Name()) == strings.ToLower(look[i])
+				couldprocess = couldprocess || matchPattern(look[i], info.Name())
 			}
 			if couldprocess {
 				// fmt.Print("path", path, "base", base)
-				curr := Stat{Count: 0, MoreSecs: math.MinInt64, LessSecs: math.MaxInt64, MoreBytes: math.MinInt64, LessBytes: math.MaxInt64}
-				ctx.dirfilesout.Directories[path] = Directory{Base: base, Path: path, Histories: make([]Stat, 0, 10), Current: curr}
+				curr := Stat{Count: 0, Scanned: ctx.starttime, MoreBytes: math.MinInt64, LessBytes: math.MaxInt64}
+				if *ctx.stats {
+					curr.sketch = newSketches()
+				}
+				ctx.dirfilesout.Directories[prefix+path] = carryHistory(ctx, Directory{Base: prefix + base, Path: prefix + path, Histories: make([]Stat, 0, 10), Current: curr})
 			} else if *ctx.flagtree {
-				paths := strings.Split(path, "\\")
+				paths := strings.Split(path, sep)
 				couldprocess = false
 				for j := 0; j < len(look); j++ {
-					couldprocess = couldprocess || strings.ToLower(paths[len(paths)-2]) == strings.ToLower(look[j])
+					couldprocess = couldprocess || matchPattern(look[j], paths[len(paths)-2])
 				}
 				if couldprocess {
 					// fmt.Printf("On pourrait traiter le répertoire %s\n", path)
 					ctx.dircount++
-					curr := walkontree(ctx, path)
-					// curr := Stat{Count: 0, MoreSecs: math.MinInt64, LessSecs: math.MaxInt64, MoreBytes: math.MinInt64, LessBytes: math.MaxInt64}
-					ctx.dirfilesout.Directories[path] = Directory{Base: base, Path: path, Histories: make([]Stat, 0, 10), Current: curr}
+					// The hierarchy is kept for -nested, tui and -incremental
+					keep := *ctx.nested != "" || ctx.command == "tui" || *ctx.incremental > 0
+					var curr Stat
+					var subdirs map[string]TreeDir
+					if keep {
+						var prev map[string]TreeDir
+						if ctx.reuse {
+							prev = ctx.previous[prefix+path].Subdirs
+						}
+						curr, subdirs = walkincremental(ctx, fsys, path, prev)
+					} else {
+						curr = walkontree(ctx, fsys, path)
+					}
+					dir := carryHistory(ctx, Directory{Base: prefix + base, Path: prefix + path, Histories: make([]Stat, 0, 10), Current: curr})
+					if *ctx.incremental > 0 {
+						dir.Subdirs = subdirs
+					}
+					ctx.dirfilesout.Directories[prefix+path] = dir
+					if keep {
+						ctx.trees[prefix+path] = subdirs
+					}
 					if *ctx.details != "" {
-						if _, err := io.WriteString(ctx.detailsout, fmt.Sprintf("%s\t%s\t%d\t%d\t%s\t%d\t%s\t%d\t%s\n", base, path,
-							curr.Count, curr.LessBytes, humanize.Bytes(uint64(curr.LessBytes)),
-							int(curr.MoreSecs.Minutes()), humanizeMinutes(int(curr.MoreSecs.Minutes())),
-							int(curr.LessSecs.Minutes()), humanizeMinutes(int(curr.LessSecs.Minutes())))); err != nil {
-							fmt.Println(err)
-							os.Exit(1)
+						usage := ""
+						if *ctx.diskusage {
+							usage = fmt.Sprintf("\t%d\t%s", curr.DiskBytes, humanize.Bytes(uint64(curr.DiskBytes)))
+						}
+						if *ctx.archives {
+							usage = usage + fmt.Sprintf("\t%d\t%d\t%d\t%s\t%.2f\t%d\t%d", curr.Archives, curr.Entries, curr.EntryBytes, humanize.Bytes(uint64(curr.EntryBytes)),
+								curr.ratio(), int(curr.entryOldestAge().Minutes()), int(curr.entryNewestAge().Minutes()))
+						}
+						if *ctx.owners {
+							usage = usage + fmt.Sprintf("\t%s\t%s\t%d\t%d", formatUsages(curr.Owners, false), formatUsages(curr.Groups, false), curr.WorldWritable, curr.Unreadable)
 						}
+						// Written in the report order (-sort)
+						ctx.treedetails[prefix+path] = fmt.Sprintf("%s\t%s\t%d\t%d\t%s\t%d\t%s\t%d\t%s%s\n", prefix+base, prefix+path,
+							curr.Count, curr.LessBytes, humanize.Bytes(uint64(curr.LessBytes)),
+							int(curr.newestAge().Minutes()), humanizeMinutes(int(curr.newestAge().Minutes())),
+							int(curr.oldestAge().Minutes()), humanizeMinutes(int(curr.oldestAge().Minutes())), usage)
 					}
+					// The subtree is already walked, not read again : the look directories it holds are part of its stat
+					return filepath.SkipDir
 				}
 			}
 		} else {
 			ctx.filecount++
 			// Not Dir. So File
-			paths := strings.Split(path, "\\")
+			paths := strings.Split(path, sep)
 			couldprocess = false
 			for i := 0; i < len(look); i++ {
-				couldprocess = couldprocess || strings.ToLower(paths[len(paths)-2]) == strings.ToLower(look[i])
+				couldprocess = couldprocess || matchPattern(look[i], paths[len(paths)-2])
 			}
 			if !*ctx.flagtree && couldprocess {
-				rootpath := strings.Join(paths[0:len(paths)-1], "\\")
-				if *ctx.details != "" {
-					if _, err := io.WriteString(ctx.detailsout, fmt.Sprintf("%s\t%s\t%v\t%d\n", rootpath, info.Name(), info.ModTime(), info.Size())); err != nil {
-						fmt.Println(err)
-						os.Exit(1)
-					}
-				}
+				rootpath := prefix + strings.Join(paths[0:len(paths)-1], sep)
 				dir := ctx.dirfilesout.Directories[rootpath]
-				dir.Current = dir.Current.registerFile(info)
+				dir.Current = countFile(ctx, fsys, rootpath, path, info, dir.Current)
 				ctx.dirfilesout.Directories[rootpath] = dir
 			}
 		}
 		return nil
 	})
-	fmt.Printf("Processed files(%d) & Directories(%d)\n", ctx.filecount, ctx.dircount)
+	if !*ctx.check {
+		fmt.Printf("Processed files(%d) & Directories(%d)\n", ctx.filecount, ctx.dircount)
+	}
 
 	if err != nil {
-		fmt.Printf("error walking the path %q: %v\n", base, err)
+		fmt.Fprintf(consoleOut(ctx), "error walking the path %q: %v\n", prefix+base, err)
 	}
 	return nil
 }
 
+// commands : Subcommands, with their usage line. Empty command is the legacy flags mode
+var commands = []struct {
+	name  string
+	usage string
+}{
+	{"scan", "Full discovery of -src directories, reset the -quickrefresh cache"},
+	{"refresh", "Refresh the directories stored in the -quickrefresh cache"},
+	{"replay", "Don't get files. Replay from the -quickrefresh cache"},
+	{"tree", "Tree Size mode on -src directories"},
+	{"check", "Nagios/Icinga check plugin (status line, perfdata & exit code)"},
+	{"serve", "Refresh periodically and expose metrics over http"},
+	{"diff", "Compare two -quickrefresh caches: bboard diff [flags] old.json new.json"},
+	{"dupes", "Duplicate files of -src directories and reclaimable bytes"},
+	{"tui", "Interactive terminal view of -src or -quickrefresh directories"},
+}
+
+// usage : Print commands list, then flags of the legacy mode
+func usage(flags *flag.FlagSet) func() {
+	return func() {
+		out := flags.Output()
+		fmt.Fprintf(out, "Usage of bboard:\n  bboard <command> [flags]\n\nCommands:\n")
+		for _, c := range commands {
+			fmt.Fprintf(out, "  %-8s %s\n", c.name, c.usage)
+		}
+		fmt.Fprintf(out, "\nUse \"bboard <command> -h\" for command flags.\nLegacy flags (without command):\n")
+		flags.PrintDefaults()
+	}
+}
+
 // Prepare Command Line Args parsing
-func setFlagList(ctx *context) {
-	ctx.src = flag.String("src", "", "Source file specification")
-	ctx.verbose = flag.Bool("verbose", false, "Verbose mode")
-	ctx.filter0 = flag.Bool("filternull", false, "Filtering 0 valued line")
-	ctx.quick = flag.String("quickrefresh", "", "File to store cached data - quicker search/trend mode")
-	ctx.exclude = flag.String("exclude", "", "Directories to exclude")
-	ctx.details = flag.String("details", "", "File to store detail data - xls format, tab separator")
-	ctx.errors = flag.String("errors", "", "File to store errors list - txt format")
-	ctx.replay = flag.Bool("replay", false, "don't get files. Replay from json file")
-	ctx.selectfile = flag.String("select", "", "File/Dir select (contains)")
-	ctx.feedback = flag.Int("feedback", 0, "Display file processing (feedback count)")
-	ctx.history = flag.Int("history", max_history, "Keep historical data maximum")
-	ctx.flagNoColor = flag.Bool("no-color", false, "Disable color output")
-	ctx.flagtree = flag.Bool("tree", false, "Tree Size mode")
-	ctx.influxdb = flag.String("influxdb", "", "Standard output for InfluxDB. Specify tablename.")
-	flag.Parse()
+// Every command gets the common flags, mode flags are only defined where they make sense
+func setFlagList(ctx *context, flags *flag.FlagSet) {
+	ctx.src = flags.String("src", "", "Source file specification")
+	ctx.verbose = flags.Bool("verbose", false, "Verbose mode")
+	ctx.filter0 = flags.Bool("filternull", false, "Filtering 0 valued line")
+	ctx.quick = flags.String("quickrefresh", "", "File to store cached data - quicker search/trend mode")
+	ctx.exclude = flags.String("exclude", "", "Directories to exclude")
+	ctx.details = flags.String("details", "", "File to store detail data - xls format, tab separator")
+	ctx.errors = flags.String("errors", "", "File to store errors list - txt format")
+	ctx.selectfile = flags.String("select", "", "File/Dir select (contains)")
+	ctx.feedback = flags.Int("feedback", 0, "Display file processing (feedback count)")
+	ctx.history = flags.Int("history", max_history, "Keep historical data maximum")
+	ctx.flagNoColor = flags.Bool("no-color", false, "Disable color output")
+	ctx.influxdb = flags.String("influxdb", "", "Standard output for InfluxDB. Specify tablename.")
+	ctx.configfile = flags.String("config", "", "Configuration file - json format (notification rules, remote sources, quotas)")
+	ctx.replay = new(bool)
+	ctx.flagtree = new(bool)
+	ctx.diskusage = new(bool)
+	ctx.archives = new(bool)
+	ctx.workers = new(int)
+	ctx.all = new(bool)
+	ctx.owners = new(bool)
+	ctx.stats = new(bool)
+	ctx.anomaly = new(float64)
+	ctx.ageby = new(string)
+	*ctx.ageby = "mtime"
+	ctx.check = new(bool)
+	ctx.watch = new(bool)
+	ctx.incremental = new(time.Duration)
+	ctx.nested = new(string)
+	ctx.sortby = new(string)
+	*ctx.sortby = "path"
+	ctx.limit = new(int)
+	ctx.warning = new(int)
+	ctx.critical = new(int)
+	switch ctx.command {
+	case "":
+		ctx.replay = flags.Bool("replay", false, "don't get files. Replay from json file")
+		ctx.flagtree = flags.Bool("tree", false, "Tree Size mode")
+		ctx.check = flags.Bool("check", false, "Nagios/Icinga check plugin mode (status line, perfdata & exit code)")
+	case "replay":
+		*ctx.replay = true
+	case "tree":
+		*ctx.flagtree = true
+		ctx.incremental = flags.Duration("incremental", 0, "Reuse cached subdirectories whose mtime is unchanged, every directory is read again after this delay (0: full walk)")
+	case "check":
+		*ctx.check = true
+	case "serve":
+		ctx.listen = flags.String("listen", ":9310", "Http listen address for /metrics and /json")
+		ctx.interval = flags.Duration("interval", 5*time.Minute, "Delay between two refresh")
+		ctx.watch = flags.Bool("watch", false, "Linux - follow the cached local directories with inotify instead of reading them at each refresh")
+	case "dupes":
+		ctx.workers = flags.Int("workers", runtime.NumCPU(), "Files hashed in parallel")
+	case "diff":
+		ctx.all = flags.Bool("all", false, "List unchanged directories too")
+	case "tui":
+		ctx.flagtree = flags.Bool("tree", false, "Tree Size mode on -src directories, expanded into their subdirectories by size")
+	}
+	if ctx.command == "" || ctx.command == "tree" {
+		ctx.nested = flags.String("nested", "", "Tree mode - file to store the subdirectories hierarchy by size, with percent of parent - nested json")
+		ctx.diskusage = flags.Bool("diskusage", false, "Tree mode - allocated size on disk, hard links counted once (Linux)")
+		ctx.archives = flags.Bool("archives", false, "Tree mode - open local zip/tar archives: entries, uncompressed size and ages")
+	}
+	if ctx.command == "" || ctx.command == "scan" || ctx.command == "refresh" || ctx.command == "tree" || ctx.command == "tui" {
+		ctx.owners = flags.Bool("owners", false, "Files count and bytes by owner and group (Linux), world-writable and unreadable files")
+	}
+	if ctx.command == "" || ctx.command == "scan" || ctx.command == "refresh" || ctx.command == "tree" || ctx.command == "serve" || ctx.command == "tui" {
+		ctx.stats = flags.Bool("stats", false, "Mean, median, p90 and p99 of file sizes and ages")
+	}
+	if ctx.command != "replay" && ctx.command != "dupes" && ctx.command != "diff" {
+		ctx.ageby = flags.String("age-by", "mtime", "Timestamp used for files age: mtime, atime, ctime or btime (creation)")
+	}
+	if ctx.command != "tree" && ctx.command != "dupes" && ctx.command != "diff" {
+		ctx.anomaly = flags.Float64("anomaly", 0, "Anomaly class when count or bytes deviate from the history baseline by this many standard deviations (0: none)")
+	}
+	if ctx.command != "dupes" && ctx.command != "diff" {
+		ctx.sortby = flags.String("sort", "path", "Report order: path, count, delta, size, age or class, :desc for descending (count:desc)")
+		ctx.limit = flags.Int("limit", 0, "Report only the first directories of the -sort order (0: all), per-file details lines keep every directory")
+	}
+	if ctx.command == "" || ctx.command == "check" {
+		ctx.warning = flags.Int("warning", 0, "Check mode - files count for WARNING state (0: none)")
+		ctx.critical = flags.Int("critical", 0, "Check mode - files count for CRITICAL state (0: none)")
+	}
 }
 
 // Check args and return error if anything is wrong
-func processArgs(ctx *context) (err error) {
-	setFlagList(ctx)
-	if *ctx.src == "" {
-		if !*ctx.replay {
+func processArgs(ctx *context, args []string) (err error) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		ctx.command = args[0]
+		args = args[1:]
+	}
+	flags := flag.NewFlagSet("bboard", flag.ExitOnError)
+	flags.Usage = usage(flags)
+	found := ctx.command == ""
+	for _, c := range commands {
+		if c.name == ctx.command {
+			found = true
+			flags = flag.NewFlagSet("bboard "+c.name, flag.ExitOnError)
+			desc := c.usage
+			flags.Usage = func() {
+				fmt.Fprintf(flags.Output(), "Usage of %s: %s\n", flags.Name(), desc)
+				flags.PrintDefaults()
+			}
+		}
+	}
+	if !found {
+		command := ctx.command
+		ctx.command = ""
+		setFlagList(ctx, flags)
+		flags.Usage()
+		if command == "help" {
+			os.Exit(0)
+		}
+		return fmt.Errorf("unknown command %q", command)
+	}
+	setFlagList(ctx, flags)
+	flags.Parse(args)
+
+	switch ctx.command {
+	case "":
+		if *ctx.src == "" && !*ctx.replay {
+			return fmt.Errorf("missing required -src argument/flag")
+		}
+	case "scan", "tree", "dupes":
+		if *ctx.src == "" {
+			return fmt.Errorf("missing required -src argument/flag")
+		}
+		if ctx.command == "dupes" && *ctx.workers < 1 {
+			return fmt.Errorf("-workers must be at least 1")
+		}
+		if *ctx.incremental > 0 && (*ctx.quick == "" || *ctx.stats) {
+			return fmt.Errorf("-incremental needs the -quickrefresh cache and can't be used with -stats")
+		}
+	case "refresh", "replay":
+		if *ctx.quick == "" {
+			return fmt.Errorf("missing required -quickrefresh argument/flag")
+		}
+	case "diff":
+		if flags.NArg() != 2 {
+			flags.Usage()
+			return fmt.Errorf("diff needs two -quickrefresh caches: old.json new.json")
+		}
+		ctx.caches = flags.Args()
+	default:
+		if *ctx.src == "" && *ctx.quick == "" {
+			return fmt.Errorf("missing required -src or -quickrefresh argument/flag")
+		}
+		if *ctx.watch && *ctx.quick == "" {
+			return fmt.Errorf("-watch needs the -quickrefresh cache")
+		}
+		if *ctx.flagtree && *ctx.src == "" {
 			return fmt.Errorf("missing required -src argument/flag")
 		}
 	}
 
-	if *ctx.flagNoColor {
+	if _, _, err := parseSort(*ctx.sortby); err != nil {
+		return err
+	}
+	if !contains(agebases, *ctx.ageby) {
+		return fmt.Errorf("invalid -age-by %q, expected one of %s", *ctx.ageby, strings.Join(agebases, ", "))
+	}
+
+	if *ctx.configfile != "" {
+		if ctx.config, err = loadConfig(*ctx.configfile); err != nil {
+			return fmt.Errorf("unable to load config %s: %v", *ctx.configfile, err)
+		}
+	}
+
+	if *ctx.flagNoColor || *ctx.check {
 		color.NoColor = true // disables colorized output
 	}
 
-	if *ctx.influxdb != "" {
+	if *ctx.influxdb != "" || *ctx.check {
 		*ctx.verbose = false
 	} else {
 		fmt.Printf("bboard - Files analysis - C.m. 2018 - V%s\n", VersionNum)
 	}
-
-	if *ctx.flagtree {
-		// *ctx.quick = ""
-	}
 	return nil
 }
 
@@ -402,13 +849,72 @@ func analyzeHist(hist []Stat) (retour string) {
 	return
 }
 
+// carryHistory : Tree command - a directory walked again keeps its cached histories and classes
+func carryHistory(ctx *context, dir Directory) Directory {
+	prev, ok := ctx.previous[dir.Path]
+	if !ok {
+		// scan - the discovery starts from empty, the rules already notified are not sent again
+		dir.Alerts = ctx.notified.Directories[dir.Path].Alerts
+		return dir
+	}
+	return dir.inherit(ctx, prev)
+}
+
+// inherit : Previous run of a directory - its stat goes to the histories (trimmed to -history), classes are kept
+func (dir Directory) inherit(ctx *context, prev Directory) Directory {
+	if len(prev.Histories) >= *ctx.history {
+		prev.Histories = prev.Histories[len(prev.Histories)-*ctx.history+1:]
+	}
+	dir.Histories = append(append(dir.Histories, prev.Histories...), prev.Current)
+	dir.Class, dir.Previous, dir.Runs, dir.Alerts, dir.Weekly = prev.Class, prev.Previous, prev.Runs, prev.Alerts, prev.Weekly
+	return dir
+}
+
 func getTrend(ctx *context, count int, hist []Stat) (bool, string) {
-	if ctx.processlist && len(hist) > 0 {
+	if (ctx.processlist || ctx.previous != nil) && len(hist) > 0 {
 		return (count > 0 || count-hist[len(hist)-1].Count != 0), fmt.Sprintf(" (%+d)%s", count-hist[len(hist)-1].Count, analyzeHist(hist))
 	}
 	return false, ""
 }
 
+// classcolors : console color used for each highlighted class
+var classcolors = map[string]color.Attribute{
+	"empty":    color.FgHiGreen,
+	"recent":   color.FgHiYellow,
+	"increase": color.FgHiMagenta,
+	"flat":     color.FgHiWhite,
+	"error":    color.FgHiRed,
+	"anomaly":  color.FgHiCyan,
+}
+
+// classify : Compare current stat with the last history entry
+// Return highlight flag, class (common/empty/recent/increase/flat/anomaly/error) and trend label
+func classify(ctx *context, file Directory) (bool, string, string) {
+	if file.Error != "" {
+		return true, "error", " (" + file.Error + ")"
+	}
+	highlight, trend := getTrend(ctx, file.Current.Count, file.Histories)
+	if why, ok := detectAnomaly(ctx, file); ok {
+		return true, "anomaly", trend + " (anomaly: " + why + ")"
+	}
+	highlight = highlight || (*ctx.replay && file.Current.Count > 0)
+	if !highlight {
+		return false, "common", trend
+	}
+	if file.Current.Count == 0 {
+		return true, "empty", trend
+	}
+	if len(file.Histories) > 0 {
+		last := file.Histories[len(file.Histories)-1].Count
+		if last == 0 {
+			return true, "recent", trend
+		} else if last < file.Current.Count {
+			return true, "increase", trend
+		}
+	}
+	return true, "flat", trend
+}
+
 // No more Wildcard and selection in this Array
 // fixedCopy because the Src array is predefined
 func fixedCount(ctx *context) {
@@ -417,72 +923,126 @@ func fixedCount(ctx *context) {
 		// fmt.Printf("Files: %d\n", ctx.filecount)
 		fmt.Printf("**START** (%v)\n", ctx.starttime)
 	}
-	for _, file := range ctx.allfilesout {
-		if *ctx.selectfile == "" || strings.Contains(strings.ToLower(file.Name()), strings.ToLower(*ctx.selectfile)) {
-			fmt.Printf("File processed : %s\n", file.Name())
-			ctx.fileprocessed++
-		}
-		// ctx.filecount++
+	if *ctx.ageby != "mtime" && *ctx.influxdb == "" && !*ctx.check {
+		fmt.Printf("Ages by %s\n", *ctx.ageby)
 	}
-	highlighted := false
 	for path, file := range ctx.dirfilesout.Directories {
-		highlight, trend := getTrend(ctx, file.Current.Count, file.Histories)
-		highlight = highlight || (*ctx.replay && file.Current.Count > 0)
+		file.Current = file.Current.summarize()
+		ctx.dirfilesout.Directories[path] = file
+	}
+	if len(ctx.config.Quotas) > 0 {
+		computeForecasts(ctx)
+	}
+	if len(ctx.config.Groups) > 0 {
+		computeGroups(ctx)
+	}
+	highlighted := false
+	entries := make([]reportEntry, 0, len(ctx.dirfilesout.Directories))
+	for _, path := range sortedPaths(ctx.dirfilesout.Directories) {
+		file := ctx.dirfilesout.Directories[path]
+		highlight, class, trend := classify(ctx, file)
 		ctx.fileprocessed = ctx.fileprocessed + uint64(file.Current.Count)
-		paths := strings.Split(strings.ToLower(path), "\\")
-		class := "common"
-		delta := 0
-		if len(file.Histories) > 0 {
-			delta = file.Current.Count - file.Histories[len(file.Histories)-1].Count
+		delta := file.delta()
+		if !*ctx.replay {
+			file = file.trackClass(class)
+			if *ctx.anomaly > 0 {
+				file = file.trackWeekly()
+			}
+			file = notifyRules(ctx, file, delta)
+			ctx.dirfilesout.Directories[path] = file
+		}
+		entries = append(entries, reportEntry{path: path, dir: file, highlight: highlight, class: class, trend: trend, delta: delta})
+	}
+	sortEntries(ctx, entries)
+	ctx.report = entries
+	ctx.dirfilesout.Order = nil
+	shown := 0
+	for _, entry := range entries {
+		path, file, highlight, class, trend, delta := entry.path, entry.dir, entry.highlight, entry.class, entry.trend, entry.delta
+		if !*ctx.filter0 || highlight {
+			if *ctx.selectfile == "" || strings.Contains(strings.ToLower(file.Path), strings.ToLower(*ctx.selectfile)) {
+				shown++
+			}
+		}
+		if *ctx.limit > 0 && shown > *ctx.limit && !*ctx.check {
+			// -limit : the directories after the first ones are not reported
+			continue
 		}
 		if highlight {
 			highlighted = true
-			if file.Current.Count == 0 {
-				color.Set(color.FgHiGreen)
-				class = "empty"
-			} else if len(file.Histories) > 0 {
-				if file.Histories[len(file.Histories)-1].Count == 0 {
-					color.Set(color.FgHiYellow)
-					class = "recent"
-				} else if file.Histories[len(file.Histories)-1].Count < file.Current.Count {
-					color.Set(color.FgHiMagenta)
-					class = "increase"
-				} else {
-					color.Set(color.FgHiWhite)
-					class = "flat"
-				}
-			} else {
-				color.Set(color.FgHiWhite)
-				class = "flat"
-			}
+			color.Set(classcolors[class])
 		}
 		// ctx.filecount = ctx.filecount + uint64(file.Current.Count)
 		if !*ctx.filter0 || highlight {
 			if *ctx.selectfile == "" || strings.Contains(strings.ToLower(file.Path), strings.ToLower(*ctx.selectfile)) {
-				if *ctx.influxdb != "" {
-					if _, err := io.WriteString(os.Stdout, fmt.Sprintf("%s,path=%s,set=%s,class=%s value=%di,delta=%di,bigger=%di,smaller=%di,older=%di,younger=%di\n",
+				if *ctx.limit > 0 || *ctx.sortby != "path" {
+					ctx.dirfilesout.Order = append(ctx.dirfilesout.Order, path)
+				}
+				if line, ok := ctx.treedetails[path]; ok {
+					if _, err := io.WriteString(ctx.detailsout, line); err != nil {
+						fmt.Println(err)
+						exit(1)
+					}
+				}
+				if *ctx.check {
+					ctx.checks = append(ctx.checks, newCheckResult(ctx, file, class))
+				} else if *ctx.influxdb != "" {
+					usage := ""
+					if *ctx.diskusage {
+						usage = fmt.Sprintf(",disk=%di", file.Current.DiskBytes)
+					}
+					if *ctx.archives {
+						usage = usage + fmt.Sprintf(",archives=%di,entries=%di,uncompressed=%di,entry_older=%di,entry_younger=%di",
+							file.Current.Archives, file.Current.Entries, file.Current.EntryBytes, int(file.Current.entryOldestAge().Seconds()), int(file.Current.entryNewestAge().Seconds()))
+					}
+					if *ctx.owners {
+						usage = usage + fmt.Sprintf(",worldwritable=%di,unreadable=%di", file.Current.WorldWritable, file.Current.Unreadable)
+					}
+					if file.Current.Sizes != nil && file.Current.Ages != nil {
+						usage = usage + file.Current.Sizes.influxFields("size") + file.Current.Ages.influxFields("age")
+					}
+					tags := ""
+					if *ctx.ageby != "mtime" {
+						tags = ",age=" + *ctx.ageby
+					}
+					if group := groupOf(ctx, file.Path); group != "" {
+						tags = tags + ",group=" + strings.Replace(group, " ", "_", -1)
+					}
+					if _, err := io.WriteString(os.Stdout, fmt.Sprintf("%s,path=%s,set=%s,class=%s%s value=%di,delta=%di,bigger=%di,smaller=%di,older=%di,younger=%di%s\n",
 						*ctx.influxdb,
 						strings.Replace(file.Path[len(file.Base):], " ", "_", -1),
-						paths[len(paths)-1],
+						strings.ToLower(lastElement(path)),
 						class,
+						tags,
 						file.Current.Count,
 						delta,
 						file.Current.MoreBytes,
 						file.Current.LessBytes,
-						int(file.Current.MoreSecs.Seconds()),
-						int(file.Current.LessSecs.Seconds()),
+						int(file.Current.oldestAge().Seconds()),
+						int(file.Current.newestAge().Seconds()),
+						usage,
 					)); err != nil {
 						fmt.Println(err)
-						os.Exit(1)
+						exit(1)
 					}
 				} else {
-					fmt.Printf("Directory processed : %s - %d files%s\n", file.Path, file.Current.Count, trend)
+					archives := ""
+					if file.Current.Archives > 0 {
+						archives = fmt.Sprintf(" - %d archives, %d entries, %s uncompressed", file.Current.Archives, file.Current.Entries, humanize.Bytes(uint64(file.Current.EntryBytes)))
+					}
+					if file.Current.WorldWritable > 0 || file.Current.Unreadable > 0 {
+						archives = archives + fmt.Sprintf(" - %d world-writable, %d unreadable", file.Current.WorldWritable, file.Current.Unreadable)
+					}
+					if file.Forecast != nil {
+						archives = archives + " - " + file.Forecast.String()
+					}
+					fmt.Printf("Directory processed : %s - %d files%s%s\n", file.Path, file.Current.Count, archives, trend)
 				}
 
 				if *ctx.details != "" && *ctx.replay {
 					if _, err := io.WriteString(ctx.detailsout, fmt.Sprintf("%s\t%d\t%s\n", file.Path, file.Current.Count, trend)); err != nil {
 						fmt.Println(err)
-						os.Exit(1)
+						exit(1)
 					}
 				}
 			}
@@ -499,6 +1059,13 @@ func fixedCount(ctx *context) {
 		}
 		// ctx.fileprocessed++
 	}
+	reportGroups(ctx)
+	if *ctx.influxdb == "" && !*ctx.check {
+		for _, forecast := range ctx.dirfilesout.Forecasts {
+			fmt.Printf("Total %s\n", forecast)
+		}
+	}
+	reportVolumes(ctx)
 	ctx.endtime = time.Now()
 	if *ctx.verbose {
 		if highlighted {
@@ -511,6 +1078,10 @@ func fixedCount(ctx *context) {
 			fmt.Println("Increase pending file(s)")
 			color.Set(color.FgHiWhite)
 			fmt.Println("No new file but pending exist")
+			color.Set(color.FgHiCyan)
+			fmt.Println("Count or size far from the history baseline (-anomaly)")
+			color.Set(color.FgHiRed)
+			fmt.Println("Unable to read directory")
 			color.Unset()
 		}
 		elapsedtime := ctx.endtime.Sub(ctx.starttime)
@@ -536,6 +1107,9 @@ func listCount(ctx *context) bool {
 	if *ctx.verbose {
 		fmt.Printf("Quick Process - %d Directories\n", len(ctx.dirfilesout.Directories))
 	}
+	if ctx.watcher != nil && ctx.watcher.overflowed() {
+		logError(ctx, "watch events lost (inotify queue overflow), directories read again\n")
+	}
 	if *ctx.replay {
 		if *ctx.verbose {
 			ctx.dircount = uint64(len(ctx.dirfilesout.Directories))
@@ -545,127 +1119,334 @@ func listCount(ctx *context) bool {
 			fmt.Println("Read Quick list")
 		}
 	} else {
-		for i, dir := range ctx.dirfilesout.Directories {
+		for _, i := range sortedPaths(ctx.dirfilesout.Directories) {
+			dir := ctx.dirfilesout.Directories[i]
 			if p_debug {
 				fmt.Printf("Refresh Quick list %s %d\n", dir.Path, dir.Current.Count)
 			}
 			ctx.dircount++
-			files, err := ioutil.ReadDir(dir.Path)
-			haserror = err != nil
-			if len(ctx.dirfilesout.Directories[i].Histories) >= *ctx.history {
-				neededHistories := dir.Histories[1:]
-				copiedHistories := make([]Stat, *ctx.history-1)
-				copy(copiedHistories, neededHistories)
-				dir.Histories = copiedHistories
+			source := dir.Path
+			if dir.Pattern != "" {
+				// Wildcard spec, the files of its directory are matched again
+				source = dir.Base
 			}
-			dir.Histories = append(dir.Histories, dir.Current)
-			curr := Stat{Count: 0, MoreSecs: math.MinInt64, LessSecs: math.MaxInt64, MoreBytes: math.MinInt64, LessBytes: math.MaxInt64}
-			for _, file := range files {
-				if !file.IsDir() {
-					if *ctx.details != "" {
-						if _, err := io.WriteString(ctx.detailsout, fmt.Sprintf("%s\t%s\t%v\t%d\n", dir.Path, file.Name(), file.ModTime(), file.Size())); err != nil {
-							fmt.Println(err)
-							os.Exit(1)
-						}
-					}
-					curr = curr.registerFile(file)
+			fsys, path, err := openSource(ctx, source)
+			curr := Stat{Count: 0, Scanned: ctx.starttime, MoreBytes: math.MinInt64, LessBytes: math.MaxInt64}
+			if *ctx.stats {
+				curr.sketch = newSketches()
+			}
+			count := func(file os.FileInfo) error {
+				if !file.IsDir() && matchPattern(dir.Pattern, file.Name()) {
+					curr = countFile(ctx, fsys, dir.Path, joinPath(fsys, path, file.Name()), file, curr)
 					ctx.filecount++
 					if uint64(*ctx.feedback) > 0 && ctx.filecount%uint64(*ctx.feedback) == 0 {
 						fmt.Printf("f/d(%d/%d)\r", ctx.filecount, ctx.dircount)
 					}
 				}
+				return nil
+			}
+			if _, local := fsys.(localFS); err == nil && local && ctx.watcher != nil {
+				var files []os.FileInfo
+				files, err = ctx.watcher.readDir(ctx, path)
+				for _, file := range files {
+					count(file)
+				}
+			} else if err == nil {
+				// Listed by batches as by the scan, a wildcard spec on a huge directory stays in constant memory
+				err = eachFile(fsys, path, count)
+			}
+			if err != nil {
+				// Keep previous stat, the directory is only flagged in error
+				haserror = true
+				logError(ctx, fmt.Sprintf("unable to read %s: %v\n", dir.Path, err))
+				dir.Error = err.Error()
+				ctx.dirfilesout.Directories[i] = dir
+				continue
+			}
+			dir.Error = ""
+			if len(ctx.dirfilesout.Directories[i].Histories) >= *ctx.history {
+				neededHistories := dir.Histories[1:]
+				copiedHistories := make([]Stat, *ctx.history-1)
+				copy(copiedHistories, neededHistories)
+				dir.Histories = copiedHistories
 			}
+			dir.Histories = append(dir.Histories, dir.Current)
 			dir.Current = curr
 			ctx.dirfilesout.Directories[i] = dir
 		}
+		recordVolumes(ctx)
 	}
 	fixedCount(ctx)
 	return haserror
 }
 
+// splitSpec : Split a trailing separator spec into the walked base and the directory name looked for
+// base\in\ looks for "in" directories under base\
+func splitSpec(spec string, sep string) (string, string, bool) {
+	paths := strings.Split(spec, sep)
+	if len(paths) <= 1 {
+		return "", "", false
+	}
+	base := paths[0] + sep
+	startat := len(paths) - 1
+	lookfor := paths[startat-1]
+	if startat > 1 {
+		startat--
+	}
+	for j := 1; j < startat; j++ {
+		base = base + paths[j] + sep
+	}
+	return base, lookfor, true
+}
+
+// walkSpec : Directory names looked for under a base path of a filesystem
+type walkSpec struct {
+	fsys FileSystem
+	base string
+	look string
+}
+
+// addSpec : Count a file or wildcard spec, or add a trailing separator spec to the walked bases
+// Return true on error. A recursive (**) spec only reports the directories holding matching files
+func addSpec(ctx *context, fsys FileSystem, spec string, recursive bool, dir map[string]*walkSpec) bool {
+	sep := fsys.Separator()
+	if !strings.HasSuffix(spec, sep) {
+		if err := getFiles(ctx, fsys, spec); err != nil {
+			logError(ctx, fmt.Sprintf("Process error: %v\n", err))
+			return true
+		}
+		if recursive && ctx.dirfilesout.Directories[fsys.Prefix()+spec].Current.Count == 0 {
+			delete(ctx.dirfilesout.Directories, fsys.Prefix()+spec)
+		}
+		return false
+	}
+	base, lookfor, ok := splitSpec(spec, sep)
+	if !ok {
+		logError(ctx, fmt.Sprintf("Process error: %s\n", spec))
+		return true
+	}
+	if w, ok := dir[fsys.Prefix()+base]; ok {
+		w.look = w.look + ";" + lookfor
+	} else {
+		dir[fsys.Prefix()+base] = &walkSpec{fsys: fsys, base: base, look: lookfor}
+	}
+	return false
+}
+
+// dropNested : Remove the bases already walked from a parent base looking for the same names
+// data\**\in\ gives a base per directory of data, only data\ is walked
+func dropNested(dir map[string]*walkSpec) {
+	for p, w := range dir {
+		sep := w.fsys.Separator()
+		for parent := strings.TrimSuffix(p, sep); strings.Contains(parent, sep); {
+			parent = parent[:strings.LastIndex(parent, sep)]
+			if outer, ok := dir[parent+sep]; ok && covers(outer.look, w.look) {
+				delete(dir, p)
+				break
+			}
+		}
+	}
+}
+
+// covers : Every name looked for by inner is looked for by outer
+func covers(outer string, inner string) bool {
+	for _, look := range strings.Split(inner, ";") {
+		if !contains(strings.Split(outer, ";"), look) {
+			return false
+		}
+	}
+	return true
+}
+
 func genericCount(ctx *context) bool {
 	var haserror bool
-	dir := map[string]string{}
+	dir := map[string]*walkSpec{}
 	specs := strings.Split(*ctx.src, ";")
 	for i := 0; i < len(specs); i++ {
-		if isWildcard(specs[i]) {
-			if err := getFiles(ctx, specs[i]); err != nil {
-				haserror = true
-				fmt.Errorf("Process error:", err)
-			}
-		} else if strings.HasSuffix(specs[i], "\\") {
-			paths := strings.Split(specs[i], "\\")
-			if len(paths) > 1 {
-				base := paths[0] + "\\"
-				startat := len(paths) - 1
-				lookfor := paths[startat-1]
-				if startat > 1 {
-					startat--
-				}
-				for j := 1; j < startat; j++ {
-					base = base + paths[j] + "\\"
-				}
-				if dir[base] != "" {
-					dir[base] = dir[base] + ";" + lookfor
-				} else {
-					dir[base] = lookfor
-				}
-			} else {
-				haserror = true
-				fmt.Errorf("Process error")
-			}
-
-		} else {
-			if err := getFiles(ctx, specs[i]); err != nil {
-				haserror = true
-				fmt.Errorf("Process error:", err)
-			}
+		fsys, spec, err := openSource(ctx, specs[i])
+		if err != nil {
+			haserror = true
+			logError(ctx, fmt.Sprintf("Process error: %v\n", err))
+			continue
+		}
+		expanded, recursive, err := expandSpec(ctx, fsys, spec)
+		if err != nil {
+			haserror = true
+			logError(ctx, fmt.Sprintf("Process error: %v\n", err))
+			continue
+		}
+		for _, spec := range expanded {
+			haserror = addSpec(ctx, fsys, spec, recursive, dir) || haserror
 		}
 	}
-	for p, look := range dir {
+	dropNested(dir)
+	for p, w := range dir {
 		if *ctx.verbose {
-			fmt.Printf("processing path %s looking for %s\n", p, look)
+			fmt.Printf("processing path %s looking for %s\n", p, w.look)
 		}
-		if err := getFilesInPath(ctx, p, look); err != nil {
+		if err := getFilesInPath(ctx, w.fsys, w.base, w.look); err != nil {
 			haserror = true
-			fmt.Errorf("Process error for path [%s] looking for %s", p, look)
+			logError(ctx, fmt.Sprintf("Process error for path [%s] looking for %s\n", p, w.look))
 		}
 	}
-
+	recordVolumes(ctx)
 	fixedCount(ctx)
 	return haserror
 }
 
 func initDataArea(ctx *context) {
-	ctx.allfilesout = make([]os.FileInfo, 0, 300)
-	ctx.dirfilesout = Directories{Src: *ctx.src, Directories: map[string]Directory{}}
+	ctx.treedetails = map[string]string{}
+	ctx.trees = map[string]map[string]TreeDir{}
+	ctx.dirfilesout = Directories{Src: *ctx.src, AgeBy: *ctx.ageby, Directories: map[string]Directory{}}
 }
 
-func getConfig(ctx *context) bool {
-	file, err := os.Open(*ctx.quick)
+// loadDirectories : Read a quickrefresh json cache file
+func loadDirectories(filename string) (Directories, error) {
+	Dir := Directories{}
+	file, err := os.Open(filename)
 	if err != nil {
-		return false
+		return Dir, err
 	}
 	defer file.Close()
-	decoder := json.NewDecoder(file)
-	Dir := Directories{}
-	err = decoder.Decode(&Dir)
+	if err = json.NewDecoder(file).Decode(&Dir); err != nil {
+		return Dir, err
+	}
+	if info, err := file.Stat(); err == nil {
+		for path, dir := range Dir.Directories {
+			dir.Current = dir.Current.migrate(info.ModTime())
+			for i := range dir.Histories {
+				dir.Histories[i] = dir.Histories[i].migrate(info.ModTime())
+			}
+			Dir.Directories[path] = dir
+		}
+	}
+	return Dir, nil
+}
+
+// errSrcMismatch : The cache was built with other -src specifications
+var errSrcMismatch = errors.New("Different Src args")
+
+// errAgeMismatch : The cache ages were computed with another -age-by timestamp
+var errAgeMismatch = errors.New("Different age-by args")
+
+func getConfig(ctx *context) error {
+	Dir, err := loadDirectories(*ctx.quick)
 	if err != nil {
-		fmt.Println("error:", err)
-		return false
+		return err
 	}
-	if *ctx.replay {
+	if *ctx.replay || *ctx.src == "" {
 		ctx.src = &Dir.Src
+		ctx.dirfilesout.Src = Dir.Src
 	}
 
 	if strings.ToLower(Dir.Src) != strings.ToLower(*ctx.src) {
-		fmt.Println("***Start from empty file. Different Src args***")
-		return false
+		return errSrcMismatch
+	}
+	Dir.AgeBy = ageBasis(Dir)
+	if *ctx.replay {
+		ctx.ageby = &Dir.AgeBy
+		ctx.dirfilesout.Volumes = Dir.Volumes
+	}
+	if Dir.AgeBy != *ctx.ageby {
+		return errAgeMismatch
 	}
 	for _, onedir := range Dir.Directories {
 		ctx.dirfilesout.Directories[onedir.Path] = onedir
 	}
-	return true
+	ctx.dirfilesout.FullScan = Dir.FullScan
+	ctx.dirfilesout.Groups = Dir.Groups
+	return nil
+}
+
+// loadCache : Choose between refresh of the cached directories (processlist) and full discovery
+// Legacy mode silently falls back to discovery, refresh and replay commands require a usable cache
+func loadCache(ctx *context) error {
+	ctx.processlist = false
+	ctx.previous = nil
+	ctx.reuse = false
+	ctx.notified = Directories{}
+	if *ctx.quick == "" {
+		return nil
+	}
+	if ctx.command == "scan" {
+		if Dir, err := loadDirectories(*ctx.quick); err == nil {
+			ctx.notified = notifiedOf(Dir)
+		}
+		return nil
+	}
+	if ctx.command == "tree" || (ctx.command == "tui" && *ctx.flagtree) {
+		// Tree is always walked again, the cache only keeps the histories (trend, forecast)
+		if err := getConfig(ctx); err == nil {
+			ctx.previous = ctx.dirfilesout.Directories
+		} else if !os.IsNotExist(err) {
+			fmt.Fprintln(consoleOut(ctx), "***Start from empty file.", err, "***")
+		}
+		fullscan, groups := ctx.dirfilesout.FullScan, ctx.dirfilesout.Groups
+		initDataArea(ctx)
+		ctx.dirfilesout.Groups = groups
+		if *ctx.incremental > 0 {
+			ctx.reuse = ctx.previous != nil && fullscan != nil && ctx.starttime.Sub(*fullscan) < *ctx.incremental
+			if !ctx.reuse {
+				fullscan = &ctx.starttime
+			}
+			ctx.dirfilesout.FullScan = fullscan
+		}
+		return nil
+	}
+	err := getConfig(ctx)
+	ctx.processlist = err == nil
+	if err != nil {
+		if ctx.command == "refresh" || ctx.command == "replay" {
+			return fmt.Errorf("unable to use cache %s: %v", *ctx.quick, err)
+		}
+		if err == errSrcMismatch {
+			fmt.Fprintln(consoleOut(ctx), "***Start from empty file. Different Src args***")
+		} else if err == errAgeMismatch {
+			fmt.Fprintln(consoleOut(ctx), "***Start from empty file. Different age-by args***")
+		} else if !os.IsNotExist(err) {
+			fmt.Fprintln(consoleOut(ctx), "error:", err)
+		}
+	}
+	return nil
+}
+
+// saveCache : Write directories into the -quickrefresh cache
+func saveCache(ctx *context) error {
+	if *ctx.quick == "" || *ctx.replay {
+		return nil
+	}
+	dirsJson, err := json.Marshal(ctx.dirfilesout)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*ctx.quick, dirsJson, 0644)
+}
+
+// runOnce : One processing cycle - load cache, count files, save cache
+func runOnce(ctx *context) (bool, error) {
+	ctx.starttime = time.Now()
+	ctx.filecount, ctx.dircount, ctx.fileprocessed = 0, 0, 0
+	ctx.checks = nil
+	ctx.agewarned = false
+	initDataArea(ctx)
+	if err := loadCache(ctx); err != nil {
+		return true, err
+	}
+
+	var haserror bool
+	if ctx.processlist {
+		haserror = listCount(ctx)
+	} else {
+		haserror = genericCount(ctx)
+	}
+	closeFilesystems(ctx)
+	if haserror && *ctx.verbose {
+		fmt.Println("\nWITH PROCESS ERROR") // handle error
+	}
+	if err := saveNested(ctx); err != nil {
+		return haserror, err
+	}
+	return haserror, saveCache(ctx)
 }
 
 // VersionNum : Litteral version
@@ -678,10 +1459,35 @@ func getConfig(ctx *context) bool {
 // 1.6 : Ajout des erreurs dans un fichier dump. Erreur non fatal dans Walk
 // 1.7 : Option influxdb pour sortir sur le Standard Output les données InfluxDB
 // 1.8 : Ajout de Treesize
-const VersionNum = "1.8"
+// 1.9 : Mode check Nagios/Icinga (status, perfdata et code retour)
+// 1.10 : Notifications (webhook, email, commande) sur changement de classe
+// 1.11 : Commande diff entre deux fichiers quickrefresh
+// 2.0 : Commandes scan, refresh, replay, tree, check, serve et diff (anciens flags conservés)
+// 2.1 : Treesize - taille allouée sur disque et liens physiques comptés une fois (-diskusage)
+// 2.2 : Abstraction des systèmes de fichiers (-src scheme://), archives zip et tar
+// 2.3 : Source S3 (s3://bucket/prefix/)
+// 2.4 : Sources SFTP et FTP, répertoire en erreur sur timeout
+// 2.5 : Treesize - contenu des archives zip et tar (-archives)
+// 2.6 : Commande dupes - fichiers en double et espace récupérable
+// 2.7 : Répartition par propriétaire et groupe, fichiers accessibles en écriture à tous ou illisibles (-owners)
+// 2.8 : Âge des fichiers par date d'accès, de changement ou de création (-age-by)
+// 2.9 : Dates absolues dans Stat, âges calculés par rapport au début du scan (migration du cache)
+// 2.10 : Moyenne, médiane et percentiles des tailles et âges par répertoire (-stats)
+// 2.11 : Classe anomaly - écart à la moyenne de l'historique et à la même heure la semaine précédente (-anomaly)
+// 2.12 : Prévision de la date d'atteinte des quotas (-config Quotas), condition FullWithin des règles, historique en mode tree
+// 2.13 : Taille, espace libre et inodes du volume de chaque base (statfs Linux), cache, synthèse, InfluxDB et Prometheus
+// 2.14 : serve -watch - répertoires locaux du cache suivis par inotify au lieu d'être relus (relecture complète si débordement)
+// 2.15 : tree -incremental - sous-répertoires dont la date de modification n'a pas changé repris du cache, relecture complète périodique
+// 2.16 : Specs avec joker regroupées en un répertoire (Pattern) avec stats et historique, détails en flux, fin de allfilesout
+// 2.17 : Jokers dans les répertoires intermédiaires de -src et ** récursif, un répertoire par correspondance
+// 2.18 : Groupes nommés (-config Groups) - cumul, historique, tendance, classes et règles par groupe
+// 2.19 : Ordre stable du rapport (-sort clé[:desc]) et -limit - console, détails, JSON et InfluxDB
+// 2.20 : Interface terminal interactive (tui) - progression, tri par colonne, filtre, détail et historique
+// 2.21 : Hiérarchie des sous-répertoires en mode tree - json imbriqué (-nested) et navigation dans tui -tree, pourcentage du parent
+const VersionNum = "2.21"
 
 func main() {
-	if err := processArgs(&contexte); err != nil {
+	if err := processArgs(&contexte, os.Args[1:]); err != nil {
 		fmt.Println(err)
 		os.Exit(2)
 	}
@@ -699,13 +1505,40 @@ func main() {
 				fmt.Println(err)
 				os.Exit(1)
 			}
+		} else if contexte.command == "diff" {
+			if _, err := io.WriteString(contexte.detailsout, "path\tstatus\told_count\tnew_count\tdelta\told_size\tnew_size\tdelta_size\told_oldest_min\tnew_oldest_min\n"); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		} else if contexte.command == "dupes" {
+			if _, err := io.WriteString(contexte.detailsout, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\n", "set", "files", "size", "reclaimable", "sha256", "path", "modified")); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
 		} else if *contexte.flagtree {
-			if _, err := io.WriteString(contexte.detailsout, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", "base", "path", "filecount", "totalsize", "size", "youngest_min", "youngest", "oldest_min", "oldest")); err != nil {
+			usage := ""
+			if *contexte.diskusage {
+				usage = "\tdisksize\tdisk"
+			}
+			if *contexte.archives {
+				usage = usage + "\tarchives\tentries\tuncompressedsize\tuncompressed\tratio\tentry_oldest_min\tentry_youngest_min"
+			}
+			if *contexte.owners {
+				usage = usage + "\towners\tgroups\tworldwritable\tunreadable"
+			}
+			if _, err := io.WriteString(contexte.detailsout, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s%s\n", "base", "path", "filecount", "totalsize", "size", "youngest_min", "youngest", "oldest_min", "oldest", usage)); err != nil {
 				fmt.Println(err)
 				os.Exit(1)
 			}
 		} else {
-			if _, err := io.WriteString(contexte.detailsout, fmt.Sprintf("%s\t%s\t%s\t%s\n", "path", "name", "modified", "size")); err != nil {
+			mode := ""
+			if *contexte.ageby != "mtime" {
+				mode = "\t" + *contexte.ageby
+			}
+			if *contexte.owners {
+				mode = mode + "\towner\tgroup\tmode"
+			}
+			if _, err := io.WriteString(contexte.detailsout, fmt.Sprintf("%s\t%s\t%s\t%s%s\n", "path", "name", "modified", "size", mode)); err != nil {
 				fmt.Println(err)
 				os.Exit(1)
 			}
@@ -721,33 +1554,43 @@ func main() {
 		defer contexte.errorsout.Close()
 	}
 
-	contexte.starttime = time.Now()
+	if contexte.command == "diff" {
+		os.Exit(diffCaches(&contexte))
+	}
 
-	if *contexte.quick != "" {
-		contexte.processlist = getConfig(&contexte)
+	if contexte.command == "serve" {
+		if err := serve(&contexte); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	}
-	initDataArea(&contexte)
 
-	if contexte.processlist {
-		if !listCount(&contexte) {
-			if *contexte.verbose {
-				fmt.Println("\nWITH PROCESS ERROR\n") // handle error
-			}
+	if contexte.command == "tui" {
+		if err := runTui(&contexte); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
+		os.Exit(0)
+	}
 
-	} else {
-		if !genericCount(&contexte) {
-			if *contexte.verbose {
-				fmt.Println("\nWITH PROCESS ERROR\n") // handle error
-			}
+	if contexte.command == "dupes" {
+		if dupes(&contexte) && *contexte.verbose {
+			fmt.Println("\nWITH PROCESS ERROR")
 		}
+		os.Exit(0)
 	}
 
-	if *contexte.quick != "" && !*contexte.replay {
-		dirs := Directories(contexte.dirfilesout)
-		dirsJson, _ := json.Marshal(dirs)
-		ioutil.WriteFile(*contexte.quick, dirsJson, 0644)
+	haserror, err := runOnce(&contexte)
+	if err != nil {
+		fmt.Println(err)
+		if *contexte.check {
+			os.Exit(checkUnknown)
+		}
+		os.Exit(2)
 	}
 
+	if *contexte.check {
+		os.Exit(checkReport(&contexte, haserror))
+	}
 	os.Exit(0)
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Nagios/Icinga plugin states, used as exit code
+const (
+	checkOK = iota
+	checkWarning
+	checkCritical
+	checkUnknown
+)
+
+var checkstates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// checkseverity : Worst state wins, CRITICAL over UNKNOWN over WARNING
+var checkseverity = []int{0, 1, 3, 2}
+
+// consoleOut : Console messages and errors. Check mode keeps stdout for the status line and perfdata
+func consoleOut(ctx *context) io.Writer {
+	if *ctx.check {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// checkResult : State of one selected directory in check mode
+type checkResult struct {
+	path  string
+	label string
+	class string
+	state int
+	count int
+	bytes int64
+	age   int64
+}
+
+// newCheckResult : Apply -warning/-critical thresholds on a directory count, an anomaly is a WARNING
+func newCheckResult(ctx *context, file Directory, class string) checkResult {
+	r := checkResult{path: file.Path, label: file.Path[len(file.Base):], class: class, count: file.Current.Count, bytes: file.Current.Bytes}
+	if r.label == "" {
+		r.label = file.Path
+	}
+	r.age = int64(file.Current.oldestAge().Seconds())
+	if file.Error != "" {
+		r.state = checkUnknown
+	} else if *ctx.critical > 0 && r.count >= *ctx.critical {
+		r.state = checkCritical
+	} else if (*ctx.warning > 0 && r.count >= *ctx.warning) || class == "anomaly" {
+		r.state = checkWarning
+	}
+	return r
+}
+
+// threshold : Perfdata threshold field, empty when not set
+func threshold(value int) string {
+	if value > 0 {
+		return fmt.Sprintf("%d", value)
+	}
+	return ""
+}
+
+// perfdata : 'label count'=value;warn;crit;min 'label bytes'=valueB 'label age'=values
+func (r checkResult) perfdata(ctx *context) string {
+	label := strings.Replace(r.label, "'", "''", -1)
+	return fmt.Sprintf("'%s count'=%d;%s;%s;0 '%s bytes'=%dB;;;0 '%s age'=%ds;;;0",
+		label, r.count, threshold(*ctx.warning), threshold(*ctx.critical),
+		label, r.bytes,
+		label, r.age)
+}
+
+// checkReport : Print the plugin status line with perfdata and return the exit code
+func checkReport(ctx *context, haserror bool) int {
+	sort.Slice(ctx.checks, func(i, j int) bool { return ctx.checks[i].path < ctx.checks[j].path })
+	state := checkOK
+	total := 0
+	alerts := []string{}
+	perfdata := []string{}
+	for _, r := range ctx.checks {
+		if checkseverity[r.state] > checkseverity[state] {
+			state = r.state
+		}
+		if r.state != checkOK {
+			alerts = append(alerts, fmt.Sprintf("%s %d files (%s)", r.path, r.count, r.class))
+		}
+		total = total + r.count
+		perfdata = append(perfdata, r.perfdata(ctx))
+	}
+	var summary string
+	if len(ctx.checks) == 0 {
+		state = checkUnknown
+		summary = "no directory selected"
+	} else if len(alerts) > 0 {
+		summary = strings.Join(alerts, ", ")
+	} else {
+		summary = fmt.Sprintf("%d directories, %d files", len(ctx.checks), total)
+	}
+	if haserror && state == checkOK {
+		state = checkUnknown
+		summary = summary + " - with process error"
+	}
+	fmt.Printf("BBOARD %s - %s|%s\n", checkstates[state], summary, strings.Join(perfdata, " "))
+	return state
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// captureStdout : Output of fn on the standard output
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	fn()
+	w.Close()
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestNewCheckResult(t *testing.T) {
+	ctx := testContext("check", "-warning", "10", "-critical", "20")
+	scanned := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	dir := func(count int, err string) Directory {
+		return Directory{Base: "/data/", Path: "/data/in", Error: err, Current: Stat{Count: count, Bytes: 100, Scanned: scanned, Oldest: scanned.Add(-90 * time.Second)}}
+	}
+	tests := []struct {
+		name  string
+		dir   Directory
+		class string
+		state int
+	}{
+		{"below", dir(9, ""), "normal", checkOK},
+		{"warning threshold", dir(10, ""), "normal", checkWarning},
+		{"critical threshold", dir(20, ""), "normal", checkCritical},
+		{"anomaly", dir(1, ""), "anomaly", checkWarning},
+		{"unreadable", dir(30, "permission denied"), "normal", checkUnknown},
+	}
+	for _, test := range tests {
+		r := newCheckResult(ctx, test.dir, test.class)
+		if r.state != test.state || r.label != "in" || r.age != 90 {
+			t.Errorf("%s: state %s label %q age %d", test.name, checkstates[r.state], r.label, r.age)
+		}
+	}
+}
+
+func TestCheckReport(t *testing.T) {
+	ok := checkResult{path: "/data/a", label: "a", class: "normal", count: 3, bytes: 30, age: 60}
+	warning := checkResult{path: "/data/b", label: "b'x", class: "normal", state: checkWarning, count: 12, bytes: 120}
+	critical := checkResult{path: "/data/c", label: "c", class: "normal", state: checkCritical, count: 25}
+	unknown := checkResult{path: "/data/d", label: "d", class: "normal", state: checkUnknown}
+	tests := []struct {
+		name     string
+		checks   []checkResult
+		haserror bool
+		code     int
+		line     string
+	}{
+		{"ok", []checkResult{ok}, false, checkOK,
+			"BBOARD OK - 1 directories, 3 files|'a count'=3;10;20;0 'a bytes'=30B;;;0 'a age'=60s;;;0\n"},
+		{"warning, quoted label", []checkResult{warning, ok}, false, checkWarning,
+			"BBOARD WARNING - /data/b 12 files (normal)|'a count'=3;10;20;0 'a bytes'=30B;;;0 'a age'=60s;;;0 'b''x count'=12;10;20;0 'b''x bytes'=120B;;;0 'b''x age'=0s;;;0\n"},
+		{"critical over unknown", []checkResult{unknown, critical}, false, checkCritical,
+			"BBOARD CRITICAL - /data/c 25 files (normal), /data/d 0 files (normal)|'c count'=25;10;20;0 'c bytes'=0B;;;0 'c age'=0s;;;0 'd count'=0;10;20;0 'd bytes'=0B;;;0 'd age'=0s;;;0\n"},
+		{"unknown over warning", []checkResult{warning, unknown}, false, checkUnknown,
+			"BBOARD UNKNOWN - /data/b 12 files (normal), /data/d 0 files (normal)|'b''x count'=12;10;20;0 'b''x bytes'=120B;;;0 'b''x age'=0s;;;0 'd count'=0;10;20;0 'd bytes'=0B;;;0 'd age'=0s;;;0\n"},
+		{"process error", []checkResult{ok}, true, checkUnknown,
+			"BBOARD UNKNOWN - 1 directories, 3 files - with process error|'a count'=3;10;20;0 'a bytes'=30B;;;0 'a age'=60s;;;0\n"},
+		{"nothing selected", nil, false, checkUnknown, "BBOARD UNKNOWN - no directory selected|\n"},
+	}
+	for _, test := range tests {
+		ctx := testContext("check", "-warning", "10", "-critical", "20")
+		ctx.checks = test.checks
+		var code int
+		line := captureStdout(t, func() { code = checkReport(ctx, test.haserror) })
+		if code != test.code || line != test.line {
+			t.Errorf("%s: exit %d\n%s want %d\n%s", test.name, code, line, test.code, test.line)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/dustin/go-humanize"
+)
+
+type (
+	// Config : Content of the -config json file
+	Config struct {
+		Rules   []Rule
+		Sources map[string]Source // Remote -src settings, by scheme://host[:port] (s3://bucket for S3)
+		Quotas  []Quota           // Size or files count limits, forecast from the histories
+		Groups  []Group           // Named rollups of directories
+	}
+
+	// Source : Connection settings of a remote -src
+	Source struct {
+		Endpoint        string // S3 - http(s)://host:port. Default AWS regional endpoint
+		Region          string // S3 - Default us-east-1
+		PathStyle       bool   // S3 - http(s)://host/bucket/ instead of http(s)://bucket.host/
+		User            string // SFTP/FTP user (overridden by user@ in -src), S3 access key
+		Password        string // SFTP/FTP password, S3 secret key
+		Token           string // S3 - session token of temporary credentials
+		KeyFile         string // SFTP - private key file
+		Passphrase      string // SFTP - private key passphrase
+		KnownHosts      string // SFTP - known_hosts file. Default ~/.ssh/known_hosts
+		InsecureHostKey bool   // SFTP - don't check the server host key
+		Timeout         int    // SFTP/FTP - seconds before a connection or directory read fails. Default 30
+	}
+)
+
+// loadConfig : Read the json configuration file
+func loadConfig(filename string) (Config, error) {
+	config := Config{}
+	file, err := os.Open(filename)
+	if err != nil {
+		return config, err
+	}
+	defer file.Close()
+	if err = json.NewDecoder(file).Decode(&config); err != nil {
+		return config, err
+	}
+	names := map[string]bool{}
+	for i, rule := range config.Rules {
+		// The notified state of a directory is kept by rule name
+		if rule.Name == "" {
+			return config, fmt.Errorf("rule %d: missing Name", i+1)
+		}
+		if names[rule.Name] {
+			return config, fmt.Errorf("rule %q: duplicate Name", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	for i, quota := range config.Quotas {
+		if quota.Size == "" {
+			continue
+		}
+		size, err := humanize.ParseBytes(quota.Size)
+		if err != nil {
+			return config, fmt.Errorf("quota %q: %v", quota.Name, err)
+		}
+		config.Quotas[i].bytes = int64(size)
+	}
+	for i := range config.Groups {
+		if err := config.Groups[i].compile(); err != nil {
+			return config, fmt.Errorf("group %q: %v", config.Groups[i].Name, err)
+		}
+	}
+	return config, nil
+}
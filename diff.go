@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+)
+
+// dirDiff : Change of one directory between two quickrefresh snapshots
+type dirDiff struct {
+	path   string
+	status string // added, removed, changed or unchanged
+	old    Stat
+	new    Stat
+	hist   []Stat
+}
+
+// diffcolors : console color of each diff status, same meaning as classcolors
+var diffcolors = map[string]color.Attribute{
+	"added":   classcolors["recent"],
+	"removed": classcolors["empty"],
+}
+
+func (d dirDiff) count() int {
+	return d.new.Count - d.old.Count
+}
+
+func (d dirDiff) bytes() int64 {
+	return d.new.Bytes - d.old.Bytes
+}
+
+func signedBytes(value int64) string {
+	if value < 0 {
+		return "-" + humanize.Bytes(uint64(-value))
+	}
+	return "+" + humanize.Bytes(uint64(value))
+}
+
+func signedMinutes(value time.Duration) string {
+	if value < 0 {
+		return "-" + humanizeMinutes(int(-value.Minutes()))
+	}
+	return "+" + humanizeMinutes(int(value.Minutes()))
+}
+
+// diffDirectories : Compare two snapshots, sorted by largest growth first
+func diffDirectories(from Directories, to Directories) []dirDiff {
+	diffs := make([]dirDiff, 0, len(to.Directories))
+	for path, dir := range to.Directories {
+		d := dirDiff{path: path, status: "added", new: dir.Current, hist: dir.Histories}
+		if previous, ok := from.Directories[path]; ok {
+			d.old = previous.Current
+			d.status = "unchanged"
+			if d.count() != 0 || d.bytes() != 0 {
+				d.status = "changed"
+			}
+		}
+		diffs = append(diffs, d)
+	}
+	for path, dir := range from.Directories {
+		if _, ok := to.Directories[path]; !ok {
+			diffs = append(diffs, dirDiff{path: path, status: "removed", old: dir.Current})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].count() != diffs[j].count() {
+			return diffs[i].count() > diffs[j].count()
+		}
+		if diffs[i].bytes() != diffs[j].bytes() {
+			return diffs[i].bytes() > diffs[j].bytes()
+		}
+		return diffs[i].path < diffs[j].path
+	})
+	return diffs
+}
+
+func (d dirDiff) String() string {
+	if d.status == "removed" {
+		return fmt.Sprintf("%-9s: %s - was %d files, %s", d.status, d.path, d.old.Count, humanize.Bytes(uint64(d.old.Bytes)))
+	}
+	line := fmt.Sprintf("%-9s: %s - %d files (%+d)%s - %s (%s)", d.status, d.path,
+		d.new.Count, d.count(), analyzeHist(d.hist),
+		humanize.Bytes(uint64(d.new.Bytes)), signedBytes(d.bytes()))
+	if d.new.Count > 0 {
+		line = line + fmt.Sprintf(" - oldest %s", humanizeMinutes(int(d.new.oldestAge().Minutes())))
+		if d.old.Count > 0 {
+			line = line + fmt.Sprintf(" (%s)", signedMinutes(d.new.oldestAge()-d.old.oldestAge()))
+		}
+	}
+	return line
+}
+
+// diffCaches : bboard diff [flags] old.json new.json
+func diffCaches(ctx *context) int {
+	from, err := loadDirectories(ctx.caches[0])
+	if err != nil {
+		fmt.Printf("unable to read %s: %v\n", ctx.caches[0], err)
+		return 3
+	}
+	to, err := loadDirectories(ctx.caches[1])
+	if err != nil {
+		fmt.Printf("unable to read %s: %v\n", ctx.caches[1], err)
+		return 3
+	}
+	if strings.ToLower(from.Src) != strings.ToLower(to.Src) {
+		fmt.Printf("***Different Src args***\n  %s\n  %s\n", from.Src, to.Src)
+	}
+	if ageBasis(from) != ageBasis(to) {
+		fmt.Printf("***Different age-by args*** %s - %s, ages are not comparable\n", ageBasis(from), ageBasis(to))
+	}
+
+	fmt.Printf("Diff %s (%d directories) -> %s (%d directories)\n", ctx.caches[0], len(from.Directories), ctx.caches[1], len(to.Directories))
+	summary := map[string]int{}
+	for _, d := range diffDirectories(from, to) {
+		if *ctx.selectfile != "" && !strings.Contains(strings.ToLower(d.path), strings.ToLower(*ctx.selectfile)) {
+			continue
+		}
+		summary[d.status]++
+		if d.status == "unchanged" && !*ctx.all {
+			continue
+		}
+		if c, ok := diffcolors[d.status]; ok {
+			color.Set(c)
+		} else if d.count() > 0 || d.bytes() > 0 {
+			color.Set(classcolors["increase"])
+		}
+		fmt.Println(d)
+		color.Unset()
+		if ctx.detailsout != nil {
+			if _, err := io.WriteString(ctx.detailsout, fmt.Sprintf("%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", d.path, d.status,
+				d.old.Count, d.new.Count, d.count(), d.old.Bytes, d.new.Bytes, d.bytes(),
+				int(d.old.oldestAge().Minutes()), int(d.new.oldestAge().Minutes()))); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+		}
+	}
+	fmt.Printf("Summary: %d added, %d removed, %d changed, %d unchanged\n",
+		summary["added"], summary["removed"], summary["changed"], summary["unchanged"])
+	return 0
+}
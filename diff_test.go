@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestDiffArgs(t *testing.T) {
+	tests := []struct {
+		args   []string
+		caches []string
+		ok     bool
+	}{
+		{[]string{"diff", "-all", "old.json", "new.json"}, []string{"old.json", "new.json"}, true},
+		{[]string{"diff", "old.json"}, nil, false},
+		{[]string{"diff", "-select", "in", "a.json", "b.json", "c.json"}, nil, false},
+	}
+	for _, test := range tests {
+		ctx := &context{}
+		err := processArgs(ctx, test.args)
+		if (err == nil) != test.ok || test.ok && (len(ctx.caches) != 2 || ctx.caches[0] != test.caches[0] || ctx.caches[1] != test.caches[1] || !*ctx.all) {
+			t.Errorf("%v: %v, caches %v", test.args, err, ctx.caches)
+		}
+	}
+}
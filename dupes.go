@@ -0,0 +1,290 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+)
+
+// partialSize : Bytes hashed first, full content is only hashed when heads match
+const partialSize = 64 * 1024
+
+// dupeFile : Candidate file for duplicate detection
+type dupeFile struct {
+	fsys  fileOpener
+	path  string
+	name  string
+	size  int64
+	mtime time.Time
+	hash  string
+	err   error
+}
+
+// dupeSet : Files with the same size and content
+type dupeSet struct {
+	size  int64
+	hash  string
+	files []dupeFile
+}
+
+// reclaimable : Bytes freed by keeping one file of the set
+func (d dupeSet) reclaimable() int64 {
+	return d.size * int64(len(d.files)-1)
+}
+
+// dupeCandidates : Files of the -src specs, resolved as by the scan, with -exclude and -select filters
+// Empty files are ignored, hard linked files and files of overlapping specs are kept once
+func dupeCandidates(ctx *context) ([]dupeFile, bool) {
+	var haserror bool
+	files := []dupeFile{}
+	exclude := strings.Split(strings.ToLower(*ctx.exclude), ";")
+	seen := map[fileID]bool{}
+	listed := map[string]bool{}
+	add := func(fsys FileSystem, path string, info os.FileInfo) {
+		name := fsys.Prefix() + path
+		if listed[name] || !info.Mode().IsRegular() || info.Size() == 0 {
+			return
+		}
+		if *ctx.selectfile != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(*ctx.selectfile)) {
+			return
+		}
+		if id, _, linked := fileUsage(info); linked {
+			if seen[id] {
+				return
+			}
+			seen[id] = true
+		}
+		listed[name] = true
+		ctx.filecount++
+		if uint64(*ctx.feedback) > 0 && ctx.filecount%uint64(*ctx.feedback) == 0 {
+			fmt.Printf("f/d(%d/%d)\r", ctx.filecount, ctx.dircount)
+		}
+		files = append(files, dupeFile{fsys: fsys.(fileOpener), path: path, name: name, size: info.Size(), mtime: info.ModTime()})
+	}
+	dir := map[string]*walkSpec{}
+	for _, src := range strings.Split(*ctx.src, ";") {
+		fsys, spec, err := openSource(ctx, src)
+		if err != nil {
+			haserror = true
+			logError(ctx, fmt.Sprintf("Process error: %v\n", err))
+			continue
+		}
+		if _, ok := fsys.(fileOpener); !ok {
+			haserror = true
+			logError(ctx, fmt.Sprintf("Process error: content of %s can't be read, skipped\n", src))
+			continue
+		}
+		expanded, _, err := expandSpec(ctx, fsys, spec)
+		if err != nil {
+			haserror = true
+			logError(ctx, fmt.Sprintf("Process error: %v\n", err))
+			continue
+		}
+		sep := fsys.Separator()
+		for _, spec := range expanded {
+			if strings.HasSuffix(spec, sep) {
+				base, lookfor, ok := splitSpec(spec, sep)
+				if !ok {
+					haserror = true
+					logError(ctx, fmt.Sprintf("Process error: %s\n", spec))
+				} else if w, ok := dir[fsys.Prefix()+base]; ok {
+					w.look = w.look + ";" + lookfor
+				} else {
+					dir[fsys.Prefix()+base] = &walkSpec{fsys: fsys, base: base, look: lookfor}
+				}
+				continue
+			}
+			// File or wildcard spec : files of its directory, as getFiles
+			dirname, pattern := splitPattern(fsys, spec)
+			ctx.dircount++
+			err := eachFile(fsys, dirname, func(file os.FileInfo) error {
+				if !file.IsDir() && matchPattern(pattern, file.Name()) {
+					add(fsys, joinPath(fsys, dirname, file.Name()), file)
+				}
+				return nil
+			})
+			if err != nil {
+				haserror = true
+				logError(ctx, fmt.Sprintf("Process error: %v\n", err))
+			}
+		}
+	}
+	// Trailing separator specs : files right under the directories looked for, as getFilesInPath
+	dropNested(dir)
+	for _, w := range dir {
+		look := strings.Split(w.look, ";")
+		sep := w.fsys.Separator()
+		err := walk(w.fsys, w.base, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				haserror = true
+				logError(ctx, fmt.Sprintf("prevent panic by handling failure accessing a path %q: %s - %v\n", w.base, path, err))
+				return filepath.SkipDir
+			}
+			if info.IsDir() {
+				if contains(exclude, strings.ToLower(info.Name())) {
+					return filepath.SkipDir
+				}
+				ctx.dircount++
+				return nil
+			}
+			paths := strings.Split(path, sep)
+			for _, l := range look {
+				if len(paths) > 1 && matchPattern(l, paths[len(paths)-2]) {
+					add(w.fsys, path, info)
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			haserror = true
+			logError(ctx, fmt.Sprintf("error walking the path %q: %v\n", w.fsys.Prefix()+w.base, err))
+		}
+	}
+	return files, haserror
+}
+
+// hashFile : sha256 of the first limit bytes, whole content when limit is 0
+func hashFile(f dupeFile, limit int64) (string, error) {
+	reader, err := f.fsys.Open(f.path)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	h := sha256.New()
+	if limit > 0 {
+		_, err = io.CopyN(h, reader, limit)
+	} else {
+		_, err = io.Copy(h, reader)
+	}
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFiles : Hash files with a pool of -workers goroutines, unreadable files are logged and dropped
+func hashFiles(ctx *context, files []dupeFile, limit int64) ([]dupeFile, bool) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < *ctx.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				files[i].hash, files[i].err = hashFile(files[i], limit)
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	var haserror bool
+	hashed := make([]dupeFile, 0, len(files))
+	for _, f := range files {
+		if f.err != nil {
+			haserror = true
+			logError(ctx, fmt.Sprintf("unable to read %s: %v\n", f.name, f.err))
+			continue
+		}
+		hashed = append(hashed, f)
+	}
+	return hashed, haserror
+}
+
+// groupFiles : Groups of at least two files sharing the same key
+func groupFiles(files []dupeFile, key func(dupeFile) string) [][]dupeFile {
+	groups := map[string][]dupeFile{}
+	for _, f := range files {
+		groups[key(f)] = append(groups[key(f)], f)
+	}
+	result := [][]dupeFile{}
+	for _, group := range groups {
+		if len(group) > 1 {
+			result = append(result, group)
+		}
+	}
+	return result
+}
+
+func flatten(groups [][]dupeFile) []dupeFile {
+	files := []dupeFile{}
+	for _, group := range groups {
+		files = append(files, group...)
+	}
+	return files
+}
+
+// findDupes : Group by size, then by partial hash, then by full hash
+// Files smaller than partialSize are fully hashed by the first pass
+func findDupes(ctx *context, files []dupeFile) ([]dupeSet, bool) {
+	bysize := func(f dupeFile) string { return fmt.Sprintf("%d", f.size) }
+	byhash := func(f dupeFile) string { return fmt.Sprintf("%d:%s", f.size, f.hash) }
+	candidates, haserror := hashFiles(ctx, flatten(groupFiles(files, bysize)), partialSize)
+	candidates = flatten(groupFiles(candidates, byhash))
+	small, large := []dupeFile{}, []dupeFile{}
+	for _, f := range candidates {
+		if f.size <= partialSize {
+			small = append(small, f)
+		} else {
+			large = append(large, f)
+		}
+	}
+	large, fullerror := hashFiles(ctx, large, 0)
+	sets := []dupeSet{}
+	for _, group := range groupFiles(append(small, large...), byhash) {
+		sort.Slice(group, func(i, j int) bool { return group[i].name < group[j].name })
+		sets = append(sets, dupeSet{size: group[0].size, hash: group[0].hash, files: group})
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		if sets[i].reclaimable() != sets[j].reclaimable() {
+			return sets[i].reclaimable() > sets[j].reclaimable()
+		}
+		return sets[i].files[0].name < sets[j].files[0].name
+	})
+	return sets, haserror || fullerror
+}
+
+// dupes : dupes command - report duplicate sets and reclaimable bytes
+func dupes(ctx *context) bool {
+	ctx.starttime = time.Now()
+	files, haserror := dupeCandidates(ctx)
+	sets, hasherror := findDupes(ctx, files)
+	ctx.endtime = time.Now()
+	var count int
+	var reclaimable int64
+	for i, set := range sets {
+		count = count + len(set.files)
+		reclaimable = reclaimable + set.reclaimable()
+		color.Set(classcolors["increase"])
+		fmt.Printf("Duplicate set %d : %d files of %s - %s reclaimable (sha256 %s)\n",
+			i+1, len(set.files), humanize.Bytes(uint64(set.size)), humanize.Bytes(uint64(set.reclaimable())), set.hash[:12])
+		color.Unset()
+		for _, f := range set.files {
+			fmt.Printf("\t%s\n", f.name)
+			if *ctx.details != "" {
+				if _, err := io.WriteString(ctx.detailsout, fmt.Sprintf("%d\t%d\t%d\t%d\t%s\t%s\t%v\n",
+					i+1, len(set.files), set.size, set.reclaimable(), set.hash, f.name, f.mtime)); err != nil {
+					fmt.Println(err)
+					exit(1)
+				}
+			}
+		}
+	}
+	fmt.Printf("Duplicates : %d sets, %d files, %s reclaimable (%d files compared in %v)\n",
+		len(sets), count, humanize.Bytes(uint64(reclaimable)), len(files), ctx.endtime.Sub(ctx.starttime))
+	closeFilesystems(ctx)
+	return haserror || hasherror
+}
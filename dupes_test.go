@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// The dupes candidates are the files the scan counts for the same -src
+func TestDupeCandidates(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"data/in/a.txt", "data/in/sub/b.txt", "data/a/in/c.txt", "data/a/out/d.txt", "data/a/in/empty.txt"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := "x"
+		if strings.HasPrefix(filepath.Base(name), "empty") {
+			content = ""
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sep := string(filepath.Separator)
+	spec := func(s string) string {
+		return dir + sep + strings.Replace(s, "/", sep, -1)
+	}
+	tests := []struct {
+		src   string
+		files []string
+	}{
+		// Only the files right under an "in" directory, not the ones of its subdirectories
+		{spec("data/in/"), []string{"data/a/in/c.txt", "data/in/a.txt"}},
+		{spec("data/*/in/"), []string{"data/a/in/c.txt", "data/in/a.txt"}},
+		{spec("data/*/*.txt"), []string{"data/in/a.txt"}},
+		{spec("data/**/*.txt"), []string{"data/a/in/c.txt", "data/a/out/d.txt", "data/in/a.txt", "data/in/sub/b.txt"}},
+		// Overlapping specs list a file once
+		{spec("data/in/") + ";" + spec("data/in/*.txt"), []string{"data/a/in/c.txt", "data/in/a.txt"}},
+		{spec("data/**/in/"), []string{"data/a/in/c.txt", "data/in/a.txt"}},
+	}
+	for _, test := range tests {
+		ctx := testContext("dupes", "-src", test.src)
+		files, haserror := dupeCandidates(ctx)
+		names := []string{}
+		for _, f := range files {
+			names = append(names, filepath.ToSlash(strings.TrimPrefix(f.name, dir+sep)))
+		}
+		sort.Strings(names)
+		if haserror || !reflect.DeepEqual(names, test.files) {
+			t.Errorf("%s: %v %v want %v", test.src, names, haserror, test.files)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+type (
+	// Quota : Size or files count limit of the selected directories (-config)
+	Quota struct {
+		Name   string
+		Select string // Path contains (like -select). Empty: every directory
+		Size   string // Size limit, like "500 GB"
+		Count  int    // Files count limit
+		Total  bool   // Limit of the selected directories together (volume), instead of each one
+		bytes  int64
+	}
+
+	// Forecast : Projected date a quota will be reached, from the trend of the histories
+	Forecast struct {
+		Quota   string
+		Metric  string // bytes or count
+		Value   int64
+		Limit   int64
+		PerDay  float64   // Growth per day, least squares over histories and current stat
+		Days    float64   // Days before the limit is reached, -1 when not growing
+		Reached time.Time // Projected date, zero when not growing or beyond forecastMaxYears
+	}
+)
+
+// forecastMinPoints : Scans needed before a trend is computed
+const forecastMinPoints = 3
+
+// forecastMaxYears : Horizon of the projected dates, a slow growth is "not reached within" it
+const forecastMaxYears = 100
+
+func (q Quota) selects(path string) bool {
+	return q.Select == "" || strings.Contains(strings.ToLower(path), strings.ToLower(q.Select))
+}
+
+// slopePerDay : Least squares growth per day of values over scan times
+// Scans sharing the same time (caches migrated from durations) are not usable
+func slopePerDay(times []time.Time, values []float64) (float64, bool) {
+	if len(times) < forecastMinPoints {
+		return 0, false
+	}
+	var sx, sy float64
+	xs := make([]float64, len(times))
+	for i, t := range times {
+		xs[i] = t.Sub(times[0]).Hours() / 24
+		sx, sy = sx+xs[i], sy+values[i]
+	}
+	mx, my := sx/float64(len(xs)), sy/float64(len(xs))
+	var cov, variance float64
+	for i := range xs {
+		cov = cov + (xs[i]-mx)*(values[i]-my)
+		variance = variance + (xs[i]-mx)*(xs[i]-mx)
+	}
+	if variance == 0 {
+		return 0, false
+	}
+	return cov / variance, true
+}
+
+// project : Forecast of one metric, nil without enough history
+func (q Quota) project(metric string, limit int64, times []time.Time, values []float64) *Forecast {
+	if limit <= 0 {
+		return nil
+	}
+	slope, ok := slopePerDay(times, values)
+	if !ok {
+		return nil
+	}
+	now := times[len(times)-1]
+	f := &Forecast{Quota: q.Name, Metric: metric, Value: int64(values[len(values)-1]), Limit: limit, PerDay: slope, Days: -1}
+	if f.Value >= limit {
+		f.Days, f.Reached = 0, now
+	} else if slope > 0 {
+		f.Days = float64(limit-f.Value) / slope
+		if !f.beyond() {
+			f.Reached = now.Add(time.Duration(f.Days * 24 * float64(time.Hour)))
+		}
+	}
+	return f
+}
+
+// beyond : Limit reached after the forecastMaxYears horizon (durations overflow after 292 years)
+func (f *Forecast) beyond() bool {
+	return f.Days > forecastMaxYears*365.25
+}
+
+// sooner : Growing forecasts first, the nearest date wins
+func (f *Forecast) sooner(other *Forecast) bool {
+	if other == nil {
+		return true
+	}
+	if (f.Days < 0) != (other.Days < 0) {
+		return f.Days >= 0
+	}
+	return f.Days < other.Days
+}
+
+func (f *Forecast) forecasts(q Quota, times []time.Time, bytes []float64, counts []float64) *Forecast {
+	for _, next := range []*Forecast{q.project("bytes", q.bytes, times, bytes), q.project("count", int64(q.Count), times, counts)} {
+		if next != nil && next.sooner(f) {
+			f = next
+		}
+	}
+	return f
+}
+
+// series : Scan times with bytes and files count of a directory, oldest first
+func (d Directory) series() ([]time.Time, []float64, []float64) {
+	times, bytes, counts := []time.Time{}, []float64{}, []float64{}
+	for _, s := range append(append([]Stat{}, d.Histories...), d.Current) {
+		if s.Scanned.IsZero() {
+			continue
+		}
+		times = append(times, s.Scanned)
+		bytes = append(bytes, float64(s.Bytes))
+		counts = append(counts, float64(s.Count))
+	}
+	return times, bytes, counts
+}
+
+// computeForecasts : Forecast of each directory (soonest of its quotas) and of the Total quotas
+// A directory also gets the forecast of a Total quota it belongs to when it is the soonest
+func computeForecasts(ctx *context) {
+	ctx.dirfilesout.Forecasts = nil
+	totals := map[string]*Forecast{}
+	for _, q := range ctx.config.Quotas {
+		if !q.Total {
+			continue
+		}
+		// A total is only known at the scans of every member : a new or pruned history would show as a jump
+		sums := map[time.Time][2]float64{}
+		members := map[time.Time]int{}
+		count := 0
+		for _, d := range ctx.dirfilesout.Directories {
+			if q.selects(d.Path) {
+				times, bytes, counts := d.series()
+				for i, t := range times {
+					sums[t] = [2]float64{sums[t][0] + bytes[i], sums[t][1] + counts[i]}
+					members[t]++
+				}
+				if len(times) > 0 {
+					count++
+				}
+			}
+		}
+		times := make([]time.Time, 0, len(sums))
+		for t := range sums {
+			if members[t] == count {
+				times = append(times, t)
+			}
+		}
+		sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+		bytes, counts := make([]float64, len(times)), make([]float64, len(times))
+		for i, t := range times {
+			bytes[i], counts[i] = sums[t][0], sums[t][1]
+		}
+		var f *Forecast
+		if f = f.forecasts(q, times, bytes, counts); f != nil {
+			totals[q.Name] = f
+			ctx.dirfilesout.Forecasts = append(ctx.dirfilesout.Forecasts, *f)
+		}
+	}
+	for path, d := range ctx.dirfilesout.Directories {
+		d.Forecast = nil
+		times, bytes, counts := d.series()
+		for _, q := range ctx.config.Quotas {
+			if !q.selects(d.Path) {
+				continue
+			}
+			if q.Total {
+				if totals[q.Name] != nil && totals[q.Name].sooner(d.Forecast) {
+					d.Forecast = totals[q.Name]
+				}
+			} else {
+				d.Forecast = d.Forecast.forecasts(q, times, bytes, counts)
+			}
+		}
+		ctx.dirfilesout.Directories[path] = d
+	}
+}
+
+func (f Forecast) format(value int64) string {
+	if f.Metric == "bytes" {
+		return humanize.Bytes(uint64(value))
+	}
+	return fmt.Sprintf("%d files", value)
+}
+
+func (f Forecast) String() string {
+	state := "not growing"
+	if f.Days == 0 {
+		state = "reached"
+	} else if f.beyond() {
+		state = fmt.Sprintf("not reached within %d years", forecastMaxYears)
+	} else if f.Days > 0 {
+		state = fmt.Sprintf("full in %s (%s)", humanizeMinutes(int(f.Days*24*60)), f.Reached.Format("2006-01-02"))
+	}
+	return fmt.Sprintf("quota %s %.0f%% (%s of %s), %s", f.Quota, 100*float64(f.Value)/float64(f.Limit), f.format(f.Value), f.format(f.Limit), state)
+}
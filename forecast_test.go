@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlopePerDay(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	days := func(offsets ...float64) []time.Time {
+		times := []time.Time{}
+		for _, d := range offsets {
+			times = append(times, start.Add(time.Duration(d*24*float64(time.Hour))))
+		}
+		return times
+	}
+	tests := []struct {
+		name   string
+		times  []time.Time
+		values []float64
+		slope  float64
+		ok     bool
+	}{
+		{"not enough scans", days(0, 1), []float64{0, 10}, 0, false},
+		{"linear", days(0, 1, 2, 3), []float64{100, 110, 120, 130}, 10, true},
+		{"hourly scans", days(0, 0.5, 1), []float64{0, 50, 100}, 100, true},
+		{"least squares", days(0, 1, 2), []float64{0, 30, 30}, 15, true},
+		{"shrinking", days(0, 2, 4), []float64{40, 20, 0}, -10, true},
+		{"same scan time", days(0, 0, 0), []float64{1, 2, 3}, 0, false},
+	}
+	for _, test := range tests {
+		slope, ok := slopePerDay(test.times, test.values)
+		if ok != test.ok || math.Abs(slope-test.slope) > 1e-9 {
+			t.Errorf("%s: slope %v %v want %v %v", test.name, slope, ok, test.slope, test.ok)
+		}
+	}
+}
+
+func TestProject(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	times := []time.Time{start, start.Add(24 * time.Hour), start.Add(48 * time.Hour)}
+	q := Quota{Name: "q"}
+	tests := []struct {
+		name    string
+		limit   int64
+		values  []float64
+		days    float64
+		reached time.Time
+		state   string
+	}{
+		{"growing", 1000, []float64{100, 200, 300}, 7, start.Add(9 * 24 * time.Hour), "full in 7 days (2024-01-10)"},
+		{"already reached", 250, []float64{100, 200, 300}, 0, times[2], "reached"},
+		{"not growing", 1000, []float64{300, 300, 300}, -1, time.Time{}, "not growing"},
+		// 500 GB growing 1 KB a day : 1.3 million years, no overflowed date
+		{"beyond the horizon", 500e9, []float64{1e9, 1e9 + 1000, 1e9 + 2000}, (500e9 - 1e9 - 2000) / 1000, time.Time{}, "not reached within 100 years"},
+	}
+	for _, test := range tests {
+		f := q.project("bytes", test.limit, times, test.values)
+		if f == nil {
+			t.Fatalf("%s: no forecast", test.name)
+		}
+		if math.Abs(f.Days-test.days) > 1e-6 || !f.Reached.Equal(test.reached) {
+			t.Errorf("%s: days %v reached %v want %v %v", test.name, f.Days, f.Reached, test.days, test.reached)
+		}
+		if !strings.HasSuffix(f.String(), test.state) {
+			t.Errorf("%s: %q want suffix %q", test.name, f.String(), test.state)
+		}
+	}
+	if f := q.project("bytes", 1000, times[:2], []float64{1, 2}); f != nil {
+		t.Errorf("forecast with 2 scans: %v", f)
+	}
+}
+
+// Members of a Total quota with histories of different lengths : only their common scans are summed
+func TestTotalForecast(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	member := func(path string, first int, counts ...int) Directory {
+		d := Directory{Path: path}
+		for i, count := range counts {
+			s := Stat{Count: count, Scanned: start.Add(time.Duration(first+i) * 24 * time.Hour)}
+			if i == len(counts)-1 {
+				d.Current = s
+			} else {
+				d.Histories = append(d.Histories, s)
+			}
+		}
+		return d
+	}
+	ctx := testContext("refresh")
+	initDataArea(ctx)
+	ctx.config.Quotas = []Quota{{Name: "volume", Select: "/data/", Count: 280, Total: true}}
+	ctx.dirfilesout.Directories["/data/a"] = member("/data/a", 0, 100, 110, 120, 130)
+	// Found by the scan of day 1, its files were there before
+	ctx.dirfilesout.Directories["/data/b"] = member("/data/b", 1, 50, 50, 50)
+	ctx.dirfilesout.Directories["/data/c"] = Directory{Path: "/data/c", Error: "permission denied"}
+	computeForecasts(ctx)
+	if len(ctx.dirfilesout.Forecasts) != 1 {
+		t.Fatalf("forecasts %+v", ctx.dirfilesout.Forecasts)
+	}
+	f := ctx.dirfilesout.Forecasts[0]
+	if f.Value != 180 || math.Abs(f.PerDay-10) > 1e-9 || math.Abs(f.Days-10) > 1e-9 {
+		t.Errorf("total forecast %+v", f)
+	}
+	if d := ctx.dirfilesout.Directories["/data/b"]; d.Forecast == nil || d.Forecast.Quota != "volume" {
+		t.Errorf("member forecast %+v", d.Forecast)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileSystem : Source walked by bboard (local disk, archive, remote server...)
+// Paths are given in the filesystem syntax, using its Separator. Prefix is prepended
+// to report and cache them, so a cached path can be opened again with openSource
+type FileSystem interface {
+	ReadDir(path string) ([]os.FileInfo, error)
+	Stat(path string) (os.FileInfo, error)
+	Separator() string
+	Prefix() string
+}
+
+// fileOpener : Filesystem able to read file content (dupes command)
+type fileOpener interface {
+	Open(path string) (io.ReadCloser, error)
+}
+
+// dirStreamer : Filesystem able to list a directory by batches, memory stays constant on huge directories
+type dirStreamer interface {
+	EachFile(path string, fn func(os.FileInfo) error) error
+}
+
+// backend : Open the filesystem of a -src URL location (part after scheme://)
+// Return the filesystem and the path inside it
+type backend func(ctx *context, location string) (FileSystem, string, error)
+
+// backends : Filesystems available by -src URL scheme. No scheme is the local disk
+var backends = map[string]backend{}
+
+// localFS : Local disk (and UNC paths on Windows)
+type localFS struct{}
+
+func (localFS) ReadDir(path string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(path)
+}
+
+func (localFS) Stat(path string) (os.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+func (localFS) Open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+func (localFS) EachFile(path string, fn func(os.FileInfo) error) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	for {
+		files, err := dir.Readdir(1024)
+		for _, file := range files {
+			if err := fn(file); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// eachFile : Files of a directory, streamed when the filesystem allows it
+func eachFile(fsys FileSystem, path string, fn func(os.FileInfo) error) error {
+	if s, ok := fsys.(dirStreamer); ok {
+		return s.EachFile(path, fn)
+	}
+	files, err := fsys.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := fn(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (localFS) Separator() string {
+	return string(os.PathSeparator)
+}
+
+func (localFS) Prefix() string {
+	return ""
+}
+
+// openSource : Resolve a -src specification or a cached path into its filesystem
+func openSource(ctx *context, spec string) (FileSystem, string, error) {
+	i := strings.Index(spec, "://")
+	if i < 0 {
+		return localFS{}, spec, nil
+	}
+	scheme := strings.ToLower(spec[:i])
+	open, ok := backends[scheme]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported source scheme %q in %s", scheme, spec)
+	}
+	return open(ctx, spec[i+3:])
+}
+
+// mountFS : Open a filesystem once per run, later calls with the same key reuse it
+// A broken connection is opened again, a failed open is not retried during the run
+func mountFS(ctx *context, key string, open func() (FileSystem, error)) (FileSystem, error) {
+	if fsys, ok := ctx.filesystems[key]; ok {
+		if c, ok := fsys.(connectedFS); !ok || c.Alive() {
+			return fsys, nil
+		}
+	}
+	if err, ok := ctx.mounterrors[key]; ok {
+		return nil, err
+	}
+	if ctx.filesystems == nil {
+		ctx.filesystems = map[string]FileSystem{}
+		ctx.mounterrors = map[string]error{}
+	}
+	fsys, err := open()
+	if err != nil {
+		ctx.mounterrors[key] = err
+		return nil, err
+	}
+	ctx.filesystems[key] = fsys
+	return fsys, nil
+}
+
+// joinPath : Append a name to a directory path, with the filesystem separator
+func joinPath(fsys FileSystem, dir string, name string) string {
+	return strings.TrimSuffix(dir, fsys.Separator()) + fsys.Separator() + name
+}
+
+// lastElement : Last element of a reported path, whatever the separator
+func lastElement(path string) string {
+	path = strings.TrimRight(path, "\\/")
+	if i := strings.LastIndexAny(path, "\\/"); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// walk : filepath.Walk on a FileSystem - lexical order, filepath.SkipDir support
+func walk(fsys FileSystem, root string, fn filepath.WalkFunc) error {
+	info, err := fsys.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(fsys, root, info, fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walkDir(fsys FileSystem, path string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+	files, err := fsys.ReadDir(path)
+	err1 := fn(path, info, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+	for _, file := range files {
+		if err := walkDir(fsys, joinPath(fsys, path, file.Name()), file, fn); err != nil {
+			if !file.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
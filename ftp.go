@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+)
+
+func init() {
+	backends["ftp"] = openFTP
+}
+
+// ftpFS : Directories of a FTP server, one control connection per host for the run
+type ftpFS struct {
+	remoteConn
+	prefix string
+	conn   *ftp.ServerConn
+}
+
+// ftpCloser : Logout and close the control connection
+// QUIT gets its own deadline, a hung server doesn't block the end of the run
+type ftpCloser struct {
+	conn    *ftp.ServerConn
+	conns   *netConns
+	timeout time.Duration
+}
+
+func (c ftpCloser) Close() error {
+	c.conns.deadline(time.Now().Add(c.timeout))
+	err := c.conn.Quit()
+	c.conns.Close()
+	return err
+}
+
+// openFTP : ftp://[user@]host[:port]/path/ - anonymous login without user
+func openFTP(ctx *context, location string) (FileSystem, string, error) {
+	user, host, path, err := remoteLocation(location, "21")
+	if err != nil {
+		return nil, "", err
+	}
+	prefix := remotePrefix("ftp", user, host)
+	fsys, err := mountFS(ctx, prefix, func() (FileSystem, error) {
+		source := remoteSource(ctx, "ftp", user, host, "21")
+		if source.User == "" {
+			source.User, source.Password = "anonymous", "anonymous"
+		}
+		return dialFTP(prefix, host, source.User, source.Password, time.Duration(source.Timeout)*time.Second)
+	})
+	return fsys, path, err
+}
+
+// dialFTP : Logged in control connection, its sockets (control and data) are closed at once on timeout
+func dialFTP(prefix string, host string, user string, password string, timeout time.Duration) (*ftpFS, error) {
+	conns := &netConns{}
+	conn, err := ftp.Dial(host, ftp.DialWithTimeout(timeout), ftp.DialWithDialFunc(conns.dial(timeout)))
+	if err != nil {
+		return nil, err
+	}
+	closer := ftpCloser{conn: conn, conns: conns, timeout: timeout}
+	if err := conn.Login(user, password); err != nil {
+		closer.Close()
+		return nil, err
+	}
+	return &ftpFS{remoteConn: remoteConn{timeout: timeout, closer: closer, abort: conns}, prefix: prefix, conn: conn}, nil
+}
+
+func (f *ftpFS) list(path string) ([]*ftp.Entry, error) {
+	var entries []*ftp.Entry
+	err := f.do(func() (err error) {
+		entries, err = f.conn.List(path)
+		return err
+	})
+	return entries, err
+}
+
+func (f *ftpFS) ReadDir(path string) ([]os.FileInfo, error) {
+	entries, err := f.list(path)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: f.prefix + path, Err: err}
+	}
+	files := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+		files = append(files, entryInfo(entry.Name, entry))
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	return files, nil
+}
+
+// entryInfo : Type, size and mtime of a listed entry
+func entryInfo(name string, entry *ftp.Entry) memInfo {
+	info := memInfo{name: name, size: int64(entry.Size), mode: 0444, mtime: entry.Time}
+	switch entry.Type {
+	case ftp.EntryTypeFolder:
+		info.mode = os.ModeDir | 0555
+	case ftp.EntryTypeLink:
+		info.mode = os.ModeSymlink | 0444
+	}
+	return info
+}
+
+// Stat : MLST when the server supports it, otherwise the entry is looked up in the listing of its parent
+func (f *ftpFS) Stat(path string) (os.FileInfo, error) {
+	path = strings.TrimRight(path, "/")
+	if path == "" {
+		return memInfo{name: "/", mode: os.ModeDir | 0555}, nil
+	}
+	name := lastElement(path)
+	var entry *ftp.Entry
+	err := f.do(func() (err error) {
+		// Precise times in listings means MLST/MLSD support
+		if f.conn.IsTimePreciseInList() {
+			entry, err = f.conn.GetEntry(path)
+			return err
+		}
+		entries, err := f.conn.List(path[:strings.LastIndex(path, "/")+1])
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.Name == name {
+				entry = e
+				return nil
+			}
+		}
+		return os.ErrNotExist
+	})
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: f.prefix + path, Err: err}
+	}
+	return entryInfo(name, entry), nil
+}
+
+func (f *ftpFS) Separator() string {
+	return "/"
+}
+
+func (f *ftpFS) Prefix() string {
+	return f.prefix
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFTP : Control connection of a FTP server on a fixed tree, with or without MLST
+// listings are directory -> lines, in LIST (unix ls) format
+func fakeFTP(t *testing.T, mlst bool, listings map[string][]string, mlsts map[string]string) (string, *[]string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	commands := &[]string{}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var data net.Listener
+		reader := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 fake\r\n")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			command, arg := line, ""
+			if i := strings.Index(line, " "); i >= 0 {
+				command, arg = line[:i], line[i+1:]
+			}
+			*commands = append(*commands, command)
+			switch command {
+			case "USER":
+				fmt.Fprint(conn, "331 password\r\n")
+			case "PASS":
+				fmt.Fprint(conn, "230 logged in\r\n")
+			case "FEAT":
+				if mlst {
+					fmt.Fprint(conn, "211-Features:\r\n MLST type*;size*;modify*;\r\n211 End\r\n")
+				} else {
+					fmt.Fprint(conn, "211-Features:\r\n SIZE\r\n211 End\r\n")
+				}
+			case "TYPE":
+				fmt.Fprint(conn, "200 binary\r\n")
+			case "EPSV":
+				data, err = net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					return
+				}
+				fmt.Fprintf(conn, "229 Entering Extended Passive Mode (|||%d|)\r\n", data.Addr().(*net.TCPAddr).Port)
+			case "LIST":
+				lines, ok := listings[arg]
+				if !ok {
+					data.Close()
+					fmt.Fprint(conn, "550 not found\r\n")
+					continue
+				}
+				dataconn, err := data.Accept()
+				data.Close()
+				if err != nil {
+					return
+				}
+				fmt.Fprint(conn, "150 listing\r\n")
+				for _, l := range lines {
+					fmt.Fprint(dataconn, l+"\r\n")
+				}
+				dataconn.Close()
+				fmt.Fprint(conn, "226 done\r\n")
+			case "MLST":
+				facts, ok := mlsts[arg]
+				if !ok {
+					fmt.Fprint(conn, "550 not found\r\n")
+					continue
+				}
+				fmt.Fprintf(conn, "250-Listing %s\r\n %s %s\r\n250 End\r\n", arg, facts, arg)
+			case "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprint(conn, "502 not implemented\r\n")
+			}
+		}
+	}()
+	return listener.Addr().String(), commands
+}
+
+func dialFake(t *testing.T, addr string) *ftpFS {
+	f, err := dialFTP("ftp://fake", addr, "anonymous", "anonymous", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// Without MLST, the entry is looked up in the listing of its parent : files are files, with their mtime
+func TestFTPStatList(t *testing.T) {
+	addr, commands := fakeFTP(t, false, map[string][]string{
+		"/out/": {
+			"-rw-r--r--    1 ftp      ftp            12 Jan 02  2024 a.csv",
+			"drwxr-xr-x    2 ftp      ftp          4096 Mar 04  2023 sub",
+		},
+	}, nil)
+	f := dialFake(t, addr)
+	tests := []struct {
+		path  string
+		dir   bool
+		size  int64
+		mtime time.Time
+	}{
+		{"/out/a.csv", false, 12, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"/out/sub/", true, 0, time.Date(2023, 3, 4, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		info, err := f.Stat(test.path)
+		if err != nil {
+			t.Fatalf("Stat(%s): %v", test.path, err)
+		}
+		if info.IsDir() != test.dir || info.Size() != test.size || !info.ModTime().Equal(test.mtime) || info.Name() != lastElement(test.path) {
+			t.Errorf("Stat(%s) = %s dir %v size %d mtime %v", test.path, info.Name(), info.IsDir(), info.Size(), info.ModTime())
+		}
+	}
+	if _, err := f.Stat("/out/missing"); err == nil {
+		t.Errorf("Stat of a missing entry succeeded")
+	}
+	if info, err := f.Stat("/"); err != nil || !info.IsDir() {
+		t.Errorf("Stat(/) = %v, %v", info, err)
+	}
+	for _, command := range *commands {
+		if command == "MLST" {
+			t.Errorf("MLST sent to a server without it")
+		}
+	}
+}
+
+// With MLST, one command on the control connection, no listing
+func TestFTPStatMLST(t *testing.T) {
+	addr, commands := fakeFTP(t, true, nil, map[string]string{
+		"/out/a.csv": "type=file;size=12;modify=20240102030405;",
+		"/out/sub":   "type=dir;modify=20230304050607;",
+	})
+	f := dialFake(t, addr)
+	info, err := f.Stat("/out/a.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IsDir() || info.Size() != 12 || !info.ModTime().Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("file Stat = dir %v size %d mtime %v", info.IsDir(), info.Size(), info.ModTime())
+	}
+	info, err = f.Stat("/out/sub/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() || info.Name() != "sub" || !info.ModTime().Equal(time.Date(2023, 3, 4, 5, 6, 7, 0, time.UTC)) {
+		t.Errorf("directory Stat = %s dir %v mtime %v", info.Name(), info.IsDir(), info.ModTime())
+	}
+	for _, command := range *commands {
+		if command == "LIST" || command == "MLSD" || command == "EPSV" {
+			t.Errorf("%s sent, MLST expected only", command)
+		}
+	}
+}
+
+// hungFTP : FTP server logging in, then never answering the hung command
+func hungFTP(t *testing.T, hung string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 fake\r\n")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch command := strings.Fields(line)[0]; {
+			case command == hung:
+			case command == "USER":
+				fmt.Fprint(conn, "331 password\r\n")
+			case command == "PASS":
+				fmt.Fprint(conn, "230 logged in\r\n")
+			case command == "TYPE":
+				fmt.Fprint(conn, "200 binary\r\n")
+			case command == "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprint(conn, "502 not implemented\r\n")
+			}
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// A hung server gives up after the timeout, its sockets are closed without QUIT round trip
+func TestFTPTimeout(t *testing.T) {
+	f, err := dialFTP("ftp://fake", hungFTP(t, "EPSV"), "anonymous", "anonymous", 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := f.ReadDir("/out/"); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("hung listing: %v", err)
+	}
+	if err := f.Close(); err != nil || f.Alive() || time.Since(start) > 2*time.Second {
+		t.Errorf("close after timeout: %v, alive %v after %v", err, f.Alive(), time.Since(start))
+	}
+
+	// End of the run on a server not answering QUIT
+	f, err = dialFTP("ftp://fake", hungFTP(t, "QUIT"), "anonymous", "anonymous", 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	f.Close()
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("QUIT blocked %v", time.Since(start))
+	}
+}
+
+// The operation blocked on a socket returns once the timeout closed it
+func TestRemoteConnTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	r := &remoteConn{timeout: 100 * time.Millisecond, closer: client}
+	ended := make(chan error, 1)
+	err := r.do(func() error {
+		_, err := client.Read(make([]byte, 1))
+		ended <- err
+		return err
+	})
+	if err == nil || r.Alive() {
+		t.Fatalf("blocked operation: %v, alive %v", err, r.Alive())
+	}
+	select {
+	case <-ended:
+	case <-time.After(time.Second):
+		t.Errorf("operation still blocked after the timeout")
+	}
+	if err := r.do(func() error { return nil }); err == nil {
+		t.Errorf("operation run on a closed connection")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+)
+
+// Group : Named rollup of directories (-config), with its own history, classes and rules
+type Group struct {
+	Name    string
+	Select  []string // Path contains any of these
+	Pattern string   // Or path wildcard, * and ? match across separators (\\*\production\in)
+	pattern *regexp.Regexp
+}
+
+// compile : Case insensitive regexp of the pattern
+func (g *Group) compile() error {
+	if g.Pattern == "" {
+		return nil
+	}
+	expr := regexp.QuoteMeta(g.Pattern)
+	expr = strings.Replace(strings.Replace(expr, `\*`, ".*", -1), `\?`, ".", -1)
+	var err error
+	g.pattern, err = regexp.Compile("(?i)^" + expr + "$")
+	return err
+}
+
+func (g Group) selects(path string) bool {
+	for _, s := range g.Select {
+		if strings.Contains(strings.ToLower(path), strings.ToLower(s)) {
+			return true
+		}
+	}
+	return g.pattern != nil && g.pattern.MatchString(path)
+}
+
+// groupOf : First group of a directory, "" when none
+func groupOf(ctx *context, path string) string {
+	for _, g := range ctx.config.Groups {
+		if g.selects(path) {
+			return g.Name
+		}
+	}
+	return ""
+}
+
+// aggregate : Stat of a group - counts and bytes summed, oldest and newest files, smallest and largest file
+func aggregate(ctx *context, members []Directory) Stat {
+	stat := Stat{Count: 0, Scanned: ctx.starttime, MoreBytes: math.MinInt64, LessBytes: math.MaxInt64}
+	for _, d := range members {
+		less, more := stat.LessBytes, stat.MoreBytes
+		lbfile, mbfile := stat.LbFile, stat.MbFile
+		stat = stat.merge(d.Current)
+		stat.LessBytes, stat.MoreBytes, stat.LbFile, stat.MbFile = less, more, lbfile, mbfile
+		if d.Current.Count > 0 && d.Current.LessBytes < stat.LessBytes {
+			stat.LessBytes, stat.LbFile = d.Current.LessBytes, d.Current.LbFile
+		}
+		if d.Current.Count > 0 && d.Current.MoreBytes > stat.MoreBytes {
+			stat.MoreBytes, stat.MbFile = d.Current.MoreBytes, d.Current.MbFile
+		}
+	}
+	return stat
+}
+
+// computeGroups : Aggregate the directories of each group, the previous group stat goes to its histories
+// Replay keeps the cached groups
+func computeGroups(ctx *context) {
+	if *ctx.replay {
+		return
+	}
+	groups := map[string]Directory{}
+	for _, g := range ctx.config.Groups {
+		members := []Directory{}
+		errors := []string{}
+		for _, d := range ctx.dirfilesout.Directories {
+			if groupOf(ctx, d.Path) == g.Name {
+				members = append(members, d)
+				if d.Error != "" {
+					errors = append(errors, d.Path)
+				}
+			}
+		}
+		sort.Strings(errors)
+		group := Directory{Path: g.Name, Histories: make([]Stat, 0, 10), Current: aggregate(ctx, members)}
+		if len(errors) > 0 {
+			group.Error = "unable to read " + strings.Join(errors, ", ")
+		}
+		if prev, ok := ctx.dirfilesout.Groups[g.Name]; ok {
+			group = group.inherit(ctx, prev)
+		} else {
+			group.Alerts = ctx.notified.Groups[g.Name].Alerts
+		}
+		groups[g.Name] = group
+	}
+	ctx.dirfilesout.Groups = groups
+}
+
+// reportGroups : Classify, notify and print each group after the directories
+func reportGroups(ctx *context) {
+	names := make([]string, 0, len(ctx.dirfilesout.Groups))
+	for name := range ctx.dirfilesout.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		group := ctx.dirfilesout.Groups[name]
+		highlight, class, trend := classify(ctx, group)
+		delta := group.delta()
+		if !*ctx.replay {
+			group = group.trackClass(class)
+			if *ctx.anomaly > 0 {
+				group = group.trackWeekly()
+			}
+			group = notifyRules(ctx, group, delta)
+			ctx.dirfilesout.Groups[name] = group
+		}
+		if *ctx.check {
+			continue
+		}
+		if *ctx.influxdb != "" {
+			if _, err := io.WriteString(os.Stdout, fmt.Sprintf("%s_group,group=%s,class=%s value=%di,delta=%di,bytes=%di,older=%di,younger=%di\n",
+				*ctx.influxdb, strings.Replace(name, " ", "_", -1), class, group.Current.Count, delta, group.Current.Bytes,
+				int(group.Current.oldestAge().Seconds()), int(group.Current.newestAge().Seconds()))); err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+			continue
+		}
+		if *ctx.filter0 && !highlight {
+			continue
+		}
+		if highlight {
+			color.Set(classcolors[class])
+		}
+		fmt.Printf("Group processed : %s - %d files, %s, oldest %s%s\n", name, group.Current.Count, humanize.Bytes(uint64(group.Current.Bytes)),
+			humanizeMinutes(int(group.Current.oldestAge().Minutes())), trend)
+		if highlight {
+			color.Unset()
+		}
+	}
+}
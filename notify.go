@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+type (
+	// Rule : Notify when a selected directory switches to one of the watched classes
+	Rule struct {
+		Name    string
+		Select  string   // Path contains (like -select). Empty: every directory
+		Classes []string // Watched classes. Default: recent & increase
+		Runs    int      // Consecutive runs in the class before notifying. Default: 1
+		Webhook string   // URL receiving a json POST
+		Email   *EmailNotifier
+		Command []string // Local command, notification json on stdin
+		// Days - notify when a quota (-config Quotas) is projected to be reached within this delay, instead of Classes
+		FullWithin float64
+	}
+
+	// EmailNotifier : SMTP settings of a rule
+	EmailNotifier struct {
+		Server   string // host:port
+		From     string
+		To       []string
+		User     string
+		Password string
+	}
+
+	// Notification : Payload sent to every notifier of a rule
+	Notification struct {
+		Rule     string
+		State    string // alert or recovered
+		Path     string
+		Class    string
+		Previous string
+		Count    int
+		Delta    int
+		Runs     int
+		Time     time.Time
+		Forecast *Forecast `json:",omitempty"`
+	}
+)
+
+const (
+	notifyAlert     = "alert"
+	notifyRecovered = "recovered"
+)
+
+// recoveredclasses : A notified directory going back to one of these classes is recovered
+var recoveredclasses = []string{"empty", "flat", "common"}
+
+var notifyclient = &http.Client{Timeout: 30 * time.Second}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) selects(path string) bool {
+	return r.Select == "" || strings.Contains(strings.ToLower(path), strings.ToLower(r.Select))
+}
+
+func (r Rule) watches(class string) bool {
+	if len(r.Classes) == 0 {
+		return class == "recent" || class == "increase"
+	}
+	return contains(r.Classes, class)
+}
+
+// trackClass : Count consecutive runs spent by the directory in its class
+func (d Directory) trackClass(class string) Directory {
+	if d.Class == class {
+		d.Runs++
+	} else {
+		d.Previous = d.Class
+		d.Class = class
+		d.Runs = 1
+	}
+	return d
+}
+
+// alerts : Rule condition on the directory, with the state stored once notified
+// A FullWithin rule watches the quota forecast, the other rules the class
+func (r Rule) alerts(d Directory) (bool, bool, string) {
+	if r.FullWithin > 0 {
+		full := d.Forecast != nil && d.Forecast.Days >= 0 && d.Forecast.Days <= r.FullWithin
+		return full, !full, "quota"
+	}
+	return r.watches(d.Class) && d.Runs >= r.Runs, contains(recoveredclasses, d.Class), d.Class
+}
+
+// notifyRules : Evaluate every rule on a directory and send de-duplicated notifications
+// Rule state is kept in the directory (stored in the quickrefresh cache)
+func notifyRules(ctx *context, d Directory, delta int) Directory {
+	for _, rule := range ctx.config.Rules {
+		if !rule.selects(d.Path) {
+			continue
+		}
+		n := Notification{Rule: rule.Name, Path: d.Path, Class: d.Class, Previous: d.Previous, Count: d.Current.Count, Delta: delta, Runs: d.Runs, Time: time.Now()}
+		if rule.FullWithin > 0 {
+			n.Forecast = d.Forecast
+		}
+		notified := d.Alerts[rule.Name]
+		alert, recovered, state := rule.alerts(d)
+		if alert && notified != state {
+			n.State = notifyAlert
+		} else if notified != "" && recovered {
+			n.State = notifyRecovered
+		} else {
+			continue
+		}
+		if err := rule.send(n); err != nil {
+			// Not stored as notified, sent again by the next run
+			logError(ctx, fmt.Sprintf("notification %q failed on %s: %v\n", rule.Name, d.Path, err))
+			continue
+		}
+		if n.State == notifyRecovered {
+			delete(d.Alerts, rule.Name)
+		} else {
+			if d.Alerts == nil {
+				d.Alerts = map[string]string{}
+			}
+			d.Alerts[rule.Name] = state
+		}
+	}
+	return d
+}
+
+// notifiedOf : Directories and groups of a cache with their notified rules only
+func notifiedOf(Dir Directories) Directories {
+	notified := Directories{Directories: map[string]Directory{}, Groups: map[string]Directory{}}
+	for path, d := range Dir.Directories {
+		if len(d.Alerts) > 0 {
+			notified.Directories[path] = Directory{Path: path, Alerts: d.Alerts}
+		}
+	}
+	for name, g := range Dir.Groups {
+		if len(g.Alerts) > 0 {
+			notified.Groups[name] = Directory{Path: name, Alerts: g.Alerts}
+		}
+	}
+	return notified
+}
+
+func (n Notification) String() string {
+	if n.Forecast != nil {
+		return fmt.Sprintf("bboard [%s] %s - %s", strings.ToUpper(n.State), n.Path, n.Forecast)
+	}
+	return fmt.Sprintf("bboard [%s] %s is %s (%d files, %+d) for %d run(s)",
+		strings.ToUpper(n.State), n.Path, n.Class, n.Count, n.Delta, n.Runs)
+}
+
+// send : Dispatch the notification to every notifier of the rule
+func (r Rule) send(n Notification) error {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	errs := []string{}
+	if r.Webhook != "" {
+		if err := sendWebhook(r.Webhook, payload); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if r.Email != nil {
+		if err := r.Email.send(n); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(r.Command) > 0 {
+		if err := runCommand(r.Command, n, payload); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func sendWebhook(url string, payload []byte) error {
+	resp, err := notifyclient.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+func (e EmailNotifier) send(n Notification) error {
+	var auth smtp.Auth
+	if e.User != "" {
+		host := e.Server
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", e.User, e.Password, host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n",
+		e.From, strings.Join(e.To, ", "), n, n.Time.Format(time.RFC1123Z), n)
+	return smtp.SendMail(e.Server, auth, e.From, e.To, []byte(msg))
+}
+
+func runCommand(command []string, n Notification, payload []byte) error {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(),
+		"BBOARD_RULE="+n.Rule,
+		"BBOARD_STATE="+n.State,
+		"BBOARD_PATH="+n.Path,
+		"BBOARD_CLASS="+n.Class,
+		fmt.Sprintf("BBOARD_COUNT=%d", n.Count),
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("command %s: %v %s", command[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
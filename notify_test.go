@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// webhookServer : Notifications received by a webhook, failing with status while it is not 0
+func webhookServer(t *testing.T, status *int) (*httptest.Server, *[]Notification) {
+	received := &[]Notification{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if *status != 0 {
+			http.Error(w, "unavailable", *status)
+			return
+		}
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("webhook payload: %v", err)
+		}
+		*received = append(*received, n)
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func TestNotifyRules(t *testing.T) {
+	status := 0
+	server, received := webhookServer(t, &status)
+	ctx := testContext("refresh")
+	ctx.config.Rules = []Rule{{Name: "in", Select: "IN", Classes: []string{"increase"}, Runs: 2, Webhook: server.URL}}
+	d := Directory{Path: "/data/in", Current: Stat{Count: 12}}
+	steps := []struct {
+		name   string
+		class  string
+		status int
+		state  string // notification sent, "" for none
+		stored string // rule state after the run
+	}{
+		{"first run in the class", "increase", 0, "", ""},
+		{"second run", "increase", 0, notifyAlert, "increase"},
+		{"same state is notified once", "increase", 0, "", "increase"},
+		{"recovery fails", "flat", http.StatusServiceUnavailable, "", "increase"},
+		{"recovery sent again", "flat", 0, notifyRecovered, ""},
+		{"still recovered", "flat", 0, "", ""},
+	}
+	for _, step := range steps {
+		status = step.status
+		*received = nil
+		d = notifyRules(ctx, d.trackClass(step.class), 3)
+		if step.state == "" && len(*received) > 0 || step.state != "" && (len(*received) != 1 || (*received)[0].State != step.state) {
+			t.Errorf("%s: sent %+v, want %q", step.name, *received, step.state)
+		}
+		if d.Alerts["in"] != step.stored {
+			t.Errorf("%s: stored %q want %q", step.name, d.Alerts["in"], step.stored)
+		}
+	}
+
+	n := Notification{}
+	status = 0
+	*received = nil
+	notifyRules(ctx, Directory{Path: "/data/in", Class: "increase", Previous: "flat", Runs: 2, Current: Stat{Count: 12}}, 3)
+	if len(*received) == 1 {
+		n = (*received)[0]
+	}
+	if n.Rule != "in" || n.State != notifyAlert || n.Path != "/data/in" || n.Class != "increase" || n.Previous != "flat" || n.Count != 12 || n.Delta != 3 || n.Runs != 2 || n.Time.IsZero() {
+		t.Errorf("webhook payload %+v", n)
+	}
+	*received = nil
+	notifyRules(ctx, Directory{Path: "/data/out", Class: "increase", Runs: 5}, 1)
+	if len(*received) > 0 {
+		t.Errorf("directory not selected notified")
+	}
+}
+
+// smtpServer : Minimal SMTP server keeping the messages received
+func smtpServer(t *testing.T) (string, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(conn)
+			fmt.Fprint(conn, "220 fake\r\n")
+			envelope := ""
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					break
+				}
+				command := strings.ToUpper(strings.Fields(line + " x")[0])
+				switch command {
+				case "EHLO", "HELO":
+					fmt.Fprint(conn, "250 fake\r\n")
+				case "MAIL", "RCPT":
+					envelope = envelope + strings.TrimSpace(line) + "\n"
+					fmt.Fprint(conn, "250 ok\r\n")
+				case "DATA":
+					fmt.Fprint(conn, "354 go on\r\n")
+					data := ""
+					for {
+						line, err := reader.ReadString('\n')
+						if err != nil || line == ".\r\n" {
+							break
+						}
+						data = data + line
+					}
+					messages <- envelope + data
+					fmt.Fprint(conn, "250 queued\r\n")
+				case "QUIT":
+					fmt.Fprint(conn, "221 bye\r\n")
+				default:
+					fmt.Fprint(conn, "250 ok\r\n")
+				}
+				if command == "QUIT" {
+					break
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String(), messages
+}
+
+func TestNotifyEmail(t *testing.T) {
+	addr, messages := smtpServer(t)
+	rule := Rule{Name: "in", Email: &EmailNotifier{Server: addr, From: "bboard@local", To: []string{"ops@local", "oncall@local"}}}
+	n := Notification{Rule: "in", State: notifyAlert, Path: "/data/in", Class: "increase", Count: 12, Delta: 3, Runs: 2}
+	if err := rule.send(n); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-messages
+	for _, want := range []string{"MAIL FROM:<bboard@local>", "RCPT TO:<ops@local>", "RCPT TO:<oncall@local>", "To: ops@local, oncall@local\r\n",
+		"Subject: bboard [ALERT] /data/in is increase (12 files, +3) for 2 run(s)\r\n"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("mail without %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestNotifyCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh command")
+	}
+	out := filepath.Join(t.TempDir(), "notified")
+	rule := Rule{Name: "in", Command: []string{"sh", "-c", `cat > "$0"; echo " $BBOARD_RULE $BBOARD_STATE $BBOARD_PATH $BBOARD_CLASS $BBOARD_COUNT" >> "$0"`, out}}
+	n := Notification{Rule: "in", State: notifyRecovered, Path: "/data/in", Class: "flat", Count: 4}
+	if err := rule.send(n); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(string(data), " ", 2)
+	var payload Notification
+	if err := json.Unmarshal([]byte(lines[0]), &payload); err != nil || payload.State != notifyRecovered || payload.Path != "/data/in" {
+		t.Errorf("command stdin %s: %v", lines[0], err)
+	}
+	if len(lines) < 2 || lines[1] != "in recovered /data/in flat 4\n" {
+		t.Errorf("command environment %q", data)
+	}
+	rule.Command = []string{"sh", "-c", "echo busy >&2; exit 3"}
+	if err := rule.send(n); err == nil || !strings.Contains(err.Error(), "busy") {
+		t.Errorf("failed command error %v", err)
+	}
+}
+
+func TestLoadConfigRules(t *testing.T) {
+	tests := []struct {
+		rules string
+		err   string
+	}{
+		{`[{"Name": "a"}, {"Name": "b"}]`, ""},
+		{`[{"Name": "a"}, {"Select": "in"}]`, "rule 2: missing Name"},
+		{`[{"Name": "a"}, {"Name": "a"}]`, `rule "a": duplicate Name`},
+	}
+	for _, test := range tests {
+		file := filepath.Join(t.TempDir(), "config.json")
+		if err := ioutil.WriteFile(file, []byte(`{"Rules": `+test.rules+`}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadConfig(file)
+		if (err == nil) != (test.err == "") || err != nil && err.Error() != test.err {
+			t.Errorf("%s: %v want %q", test.rules, err, test.err)
+		}
+	}
+}
+
+// A scan starts from an empty cache but doesn't notify again the rules already sent
+func TestScanKeepsNotified(t *testing.T) {
+	cache := filepath.Join(t.TempDir(), "cache.json")
+	previous := Directories{Src: "/data/in/", Directories: map[string]Directory{
+		"/data/in/a": {Path: "/data/in/a", Class: "increase", Runs: 4, Alerts: map[string]string{"in": "increase"}, Histories: []Stat{{Count: 1}}},
+		"/data/in/b": {Path: "/data/in/b", Class: "flat"},
+	}, Groups: map[string]Directory{"inbound": {Path: "inbound", Alerts: map[string]string{"in": "recent"}}}}
+	data, err := json.Marshal(previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(cache, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := testContext("scan", "-src", "/data/in/", "-quickrefresh", cache)
+	if err := loadCache(ctx); err != nil {
+		t.Fatal(err)
+	}
+	a := carryHistory(ctx, Directory{Path: "/data/in/a"})
+	if a.Alerts["in"] != "increase" || len(a.Histories) != 0 || a.Class != "" {
+		t.Errorf("scanned directory %+v", a)
+	}
+	if b := carryHistory(ctx, Directory{Path: "/data/in/b"}); b.Alerts != nil {
+		t.Errorf("not notified directory %+v", b)
+	}
+	if g := ctx.notified.Groups["inbound"]; g.Alerts["in"] != "recent" {
+		t.Errorf("group %+v", g)
+	}
+}
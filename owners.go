@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Usage : Files count and bytes of an owner or a group
+type Usage struct {
+	Count int
+	Bytes int64
+}
+
+// usernames, groupnames : Resolved uid/gid, unknown ids are kept numeric
+var (
+	usernames  = map[uint32]string{}
+	groupnames = map[uint32]string{}
+)
+
+func userName(uid uint32) string {
+	if name, ok := usernames[uid]; ok {
+		return name
+	}
+	name := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+	usernames[uid] = name
+	return name
+}
+
+func groupName(gid uint32) string {
+	if name, ok := groupnames[gid]; ok {
+		return name
+	}
+	name := strconv.FormatUint(uint64(gid), 10)
+	if g, err := user.LookupGroupId(name); err == nil {
+		name = g.Name
+	}
+	groupnames[gid] = name
+	return name
+}
+
+// fileOwnerNames : Owner and group names of a file, empty when not available
+func fileOwnerNames(info os.FileInfo) (string, string) {
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		return "", ""
+	}
+	return userName(uid), groupName(gid)
+}
+
+// worldWritable : Regular file writable by anyone (symlinks are always 0777)
+func worldWritable(info os.FileInfo) bool {
+	return info.Mode().IsRegular() && info.Mode().Perm()&0002 != 0
+}
+
+// registerOwner : Add a file to the owner/group breakdown and permission flags (-owners)
+// Readability is only checked on the local disk
+func (s Stat) registerOwner(fsys FileSystem, path string, file os.FileInfo) Stat {
+	if file.IsDir() {
+		return s
+	}
+	if owner, group := fileOwnerNames(file); owner != "" {
+		if s.Owners == nil {
+			s.Owners, s.Groups = map[string]Usage{}, map[string]Usage{}
+		}
+		s.Owners[owner] = s.Owners[owner].add(file)
+		s.Groups[group] = s.Groups[group].add(file)
+	}
+	if worldWritable(file) {
+		s.WorldWritable++
+	}
+	if _, local := fsys.(localFS); local && !readable(path) {
+		s.Unreadable++
+	}
+	return s
+}
+
+func (u Usage) add(file os.FileInfo) Usage {
+	u.Count++
+	u.Bytes = u.Bytes + file.Size()
+	return u
+}
+
+// formatUsages : name:count:bytes list, largest first - details and console output
+func formatUsages(usages map[string]Usage, human bool) string {
+	names := make([]string, 0, len(usages))
+	for name := range usages {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if usages[names[i]].Bytes != usages[names[j]].Bytes {
+			return usages[names[i]].Bytes > usages[names[j]].Bytes
+		}
+		return names[i] < names[j]
+	})
+	list := make([]string, 0, len(names))
+	for _, name := range names {
+		if human {
+			list = append(list, fmt.Sprintf("%s %d files-%s", name, usages[name].Count, humanize.Bytes(uint64(usages[name].Bytes))))
+		} else {
+			list = append(list, fmt.Sprintf("%s:%d:%d", name, usages[name].Count, usages[name].Bytes))
+		}
+	}
+	return strings.Join(list, ",")
+}
+
+// fileMode : owner, group and permissions columns of a file details line (-owners)
+func fileMode(file os.FileInfo) string {
+	owner, group := fileOwnerNames(file)
+	return fmt.Sprintf("\t%s\t%s\t%v", owner, group, file.Mode())
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// connectedFS : Filesystem holding a server connection
+// It is reopened by mountFS once broken (timeout), and closed at the end of each run
+type connectedFS interface {
+	FileSystem
+	io.Closer
+	Alive() bool
+}
+
+// remoteConn : Timeout handling shared by connected filesystems
+type remoteConn struct {
+	timeout time.Duration
+	closer  io.Closer
+	abort   io.Closer // Sockets closed on timeout, without a round trip to the hung server. Default closer
+	broken  bool
+}
+
+// do : Run a remote operation, give up after the timeout
+// The sockets are closed so the blocked call returns and its goroutine ends, the next directory reconnects
+func (r *remoteConn) do(op func() error) error {
+	if r.broken {
+		return fmt.Errorf("connection closed after a previous timeout")
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- op()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(r.timeout):
+		r.broken = true
+		if r.abort != nil {
+			r.abort.Close()
+		} else {
+			r.closer.Close()
+		}
+		return fmt.Errorf("timeout after %v", r.timeout)
+	}
+}
+
+func (r *remoteConn) Close() error {
+	if r.broken {
+		return nil
+	}
+	r.broken = true
+	return r.closer.Close()
+}
+
+func (r *remoteConn) Alive() bool {
+	return !r.broken
+}
+
+// netConns : Sockets dialed for one connection (FTP control and data connections)
+type netConns struct {
+	lock  sync.Mutex
+	conns map[net.Conn]bool
+}
+
+// trackedConn : Socket forgotten by its netConns once closed
+type trackedConn struct {
+	net.Conn
+	owner *netConns
+}
+
+func (c trackedConn) Close() error {
+	c.owner.lock.Lock()
+	delete(c.owner.conns, c.Conn)
+	c.owner.lock.Unlock()
+	return c.Conn.Close()
+}
+
+// dial : Dial function keeping the opened sockets
+func (n *netConns) dial(timeout time.Duration) func(network, address string) (net.Conn, error) {
+	return func(network, address string) (net.Conn, error) {
+		conn, err := net.DialTimeout(network, address, timeout)
+		if err != nil {
+			return nil, err
+		}
+		n.lock.Lock()
+		defer n.lock.Unlock()
+		if n.conns == nil {
+			n.conns = map[net.Conn]bool{}
+		}
+		n.conns[conn] = true
+		return trackedConn{Conn: conn, owner: n}, nil
+	}
+}
+
+// deadline : Bound the next reads and writes of every open socket
+func (n *netConns) deadline(t time.Time) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	for conn := range n.conns {
+		conn.SetDeadline(t)
+	}
+}
+
+// Close : Close every open socket, the calls blocked on them return
+func (n *netConns) Close() error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	for conn := range n.conns {
+		conn.Close()
+	}
+	n.conns = nil
+	return nil
+}
+
+// closeFilesystems : Release the connections opened during the run
+func closeFilesystems(ctx *context) {
+	for key, fsys := range ctx.filesystems {
+		if c, ok := fsys.(connectedFS); ok {
+			c.Close()
+		}
+		delete(ctx.filesystems, key)
+	}
+	ctx.mounterrors = nil
+}
+
+// remoteLocation : Split [user@]host[:port]/path into user, host:port (default port added) and path
+func remoteLocation(location string, port string) (string, string, string, error) {
+	authority, path := location, "/"
+	if i := strings.Index(location, "/"); i >= 0 {
+		authority, path = location[:i], location[i:]
+	}
+	u, err := url.Parse("//" + authority)
+	if err != nil {
+		return "", "", "", err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = host + ":" + port
+	}
+	return u.User.Username(), host, path, nil
+}
+
+// remoteSource : Config source of scheme://host (with or without the port), user from -src wins
+func remoteSource(ctx *context, scheme string, user string, host string, defaultport string) Source {
+	source, ok := ctx.config.Sources[scheme+"://"+host]
+	if !ok {
+		source = ctx.config.Sources[scheme+"://"+strings.TrimSuffix(host, ":"+defaultport)]
+	}
+	if user != "" {
+		source.User = user
+	}
+	if source.Timeout <= 0 {
+		source.Timeout = 30
+	}
+	return source
+}
+
+// remotePrefix : scheme://[user@]host:port, used to report and reopen cached paths
+func remotePrefix(scheme string, user string, host string) string {
+	if user != "" {
+		return scheme + "://" + user + "@" + host
+	}
+	return scheme + "://" + host
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	backends["s3"] = openS3
+}
+
+// emptySHA256 : Payload hash of a request without body
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3FS : S3 compatible bucket. Key prefixes ending with "/" are the directories
+type s3FS struct {
+	bucket string
+	source Source
+	client *http.Client
+}
+
+// listBucketResult : ListObjectsV2 response
+type listBucketResult struct {
+	Contents []struct {
+		Key          string
+		LastModified time.Time
+		Size         int64
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// s3Error : Error response of S3 requests
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// openS3 : s3://bucket/prefix/
+// Settings come from the "s3://bucket" config source, or the AWS_* environment variables
+func openS3(ctx *context, location string) (FileSystem, string, error) {
+	bucket, path := location, "/"
+	if i := strings.Index(location, "/"); i >= 0 {
+		bucket, path = location[:i], location[i:]
+	}
+	fsys, err := mountFS(ctx, "s3://"+bucket, func() (FileSystem, error) {
+		source, ok := ctx.config.Sources["s3://"+bucket]
+		if !ok {
+			source = Source{
+				Endpoint: os.Getenv("AWS_ENDPOINT_URL"),
+				Region:   os.Getenv("AWS_REGION"),
+				User:     os.Getenv("AWS_ACCESS_KEY_ID"),
+				Password: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+				Token:    os.Getenv("AWS_SESSION_TOKEN"),
+			}
+		}
+		if source.Region == "" {
+			source.Region = "us-east-1"
+		}
+		if source.Endpoint == "" {
+			source.Endpoint = "https://s3." + source.Region + ".amazonaws.com"
+		} else if !ok {
+			source.PathStyle = true
+		}
+		return &s3FS{bucket: bucket, source: source, client: &http.Client{Timeout: time.Minute}}, nil
+	})
+	return fsys, path, err
+}
+
+func (s *s3FS) Separator() string {
+	return "/"
+}
+
+func (s *s3FS) Prefix() string {
+	return "s3://" + s.bucket
+}
+
+// keyPrefix : Directory path (/a/b) to S3 key prefix (a/b/)
+func keyPrefix(path string) string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return ""
+	}
+	return path + "/"
+}
+
+func (s *s3FS) ReadDir(path string) ([]os.FileInfo, error) {
+	files := []os.FileInfo{}
+	if err := s.EachFile(path, func(file os.FileInfo) error {
+		files = append(files, file)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	return files, nil
+}
+
+// EachFile : Keys and common prefixes of a directory, one ListObjectsV2 page (1000 keys) at a time
+func (s *s3FS) EachFile(path string, fn func(os.FileInfo) error) error {
+	prefix := keyPrefix(path)
+	token := ""
+	for {
+		result, err := s.list(prefix, token, 1000)
+		if err != nil {
+			return &os.PathError{Op: "readdir", Path: s.Prefix() + path, Err: err}
+		}
+		for _, object := range result.Contents {
+			if object.Key == prefix {
+				continue // directory marker
+			}
+			if err := fn(memInfo{name: object.Key[len(prefix):], size: object.Size, mode: 0444, mtime: object.LastModified}); err != nil {
+				return err
+			}
+		}
+		for _, common := range result.CommonPrefixes {
+			if err := fn(memInfo{name: strings.TrimSuffix(common.Prefix[len(prefix):], "/"), mode: os.ModeDir | 0555}); err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Stat : Only directories are looked up - a prefix exists when at least one key uses it
+func (s *s3FS) Stat(path string) (os.FileInfo, error) {
+	prefix := keyPrefix(path)
+	name := lastElement(path)
+	if prefix == "" {
+		return memInfo{name: "/", mode: os.ModeDir | 0555}, nil
+	}
+	result, err := s.list(prefix, "", 1)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: s.Prefix() + path, Err: err}
+	}
+	if len(result.Contents) == 0 && len(result.CommonPrefixes) == 0 {
+		return nil, &os.PathError{Op: "stat", Path: s.Prefix() + path, Err: os.ErrNotExist}
+	}
+	return memInfo{name: name, mode: os.ModeDir | 0555}, nil
+}
+
+// list : One page of ListObjectsV2, "/" delimited
+func (s *s3FS) list(prefix string, token string, max int) (listBucketResult, error) {
+	result := listBucketResult{}
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("delimiter", "/")
+	query.Set("prefix", prefix)
+	query.Set("max-keys", fmt.Sprintf("%d", max))
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+	endpoint, err := url.Parse(s.source.Endpoint)
+	if err != nil {
+		return result, err
+	}
+	if s.source.PathStyle {
+		endpoint.Path = "/" + s.bucket + "/"
+	} else {
+		endpoint.Host = s.bucket + "." + endpoint.Host
+		endpoint.Path = "/"
+	}
+	endpoint.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest("GET", endpoint.String(), nil)
+	if err != nil {
+		return result, err
+	}
+	if s.source.User != "" {
+		signV4(req, s.source, time.Now())
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		e := s3Error{}
+		body, _ := io.ReadAll(resp.Body)
+		if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+			return result, fmt.Errorf("%s: %s", e.Code, e.Message)
+		}
+		return result, fmt.Errorf("%s", resp.Status)
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
+
+// uriEncode : RFC 3986 encoding required by AWS signature
+func uriEncode(value string, path bool) string {
+	var out strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			out.WriteByte(b)
+		case b == '/' && path:
+			out.WriteByte(b)
+		default:
+			fmt.Fprintf(&out, "%%%02X", b)
+		}
+	}
+	return out.String()
+}
+
+// canonicalQuery : Query string sorted by key, AWS encoded
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, uriEncode(key, false)+"="+uriEncode(value, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signV4 : AWS Signature Version 4 of a request without body, with the session token of temporary credentials
+func signV4(req *http.Request, source Source, now time.Time) {
+	amzdate := now.UTC().Format("20060102T150405Z")
+	scope := amzdate[:8] + "/" + source.Region + "/s3/aws4_request"
+	req.Header.Set("x-amz-date", amzdate)
+	req.Header.Set("x-amz-content-sha256", emptySHA256)
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	headers := []string{"host:" + req.URL.Host, "x-amz-content-sha256:" + emptySHA256, "x-amz-date:" + amzdate}
+	if source.Token != "" {
+		req.Header.Set("x-amz-security-token", source.Token)
+		signed = signed + ";x-amz-security-token"
+		headers = append(headers, "x-amz-security-token:"+source.Token)
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, true),
+		req.URL.RawQuery,
+		strings.Join(headers, "\n"),
+		"",
+		signed,
+		emptySHA256,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonical))
+	tosign := "AWS4-HMAC-SHA256\n" + amzdate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+	key := hmacSHA256([]byte("AWS4"+source.Password), amzdate[:8])
+	key = hmacSHA256(key, source.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		source.User, scope, signed, hex.EncodeToString(hmacSHA256(key, tosign))))
+}
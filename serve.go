@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serve : Refresh every -interval and expose the last results over http
+// /metrics : Prometheus text format, /json : directories as stored in the quickrefresh cache
+// -watch : the cached local directories are listed from inotify events (Linux)
+func serve(ctx *context) error {
+	if *ctx.watch {
+		w, err := newWatcher()
+		if err != nil {
+			return err
+		}
+		ctx.watcher = w
+	}
+	var lock sync.Mutex
+	var metrics, dirs []byte
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(metrics)
+	})
+	http.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(dirs)
+	})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- http.ListenAndServe(*ctx.listen, nil)
+	}()
+	fmt.Printf("Serving metrics on %s every %v\n", *ctx.listen, *ctx.interval)
+
+	for {
+		haserror, err := runOnce(ctx)
+		if err != nil {
+			return err
+		}
+		m := prometheusMetrics(ctx, haserror)
+		d, err := json.Marshal(ctx.dirfilesout)
+		if err != nil {
+			return err
+		}
+		lock.Lock()
+		metrics, dirs = m, d
+		lock.Unlock()
+		select {
+		case err := <-errs:
+			return err
+		case <-time.After(*ctx.interval):
+		}
+	}
+}
+
+var promescaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promLabels : path, set (last path element) and class labels of a directory
+func promLabels(dir Directory) string {
+	return fmt.Sprintf(`path="%s",set="%s",class="%s"`,
+		promescaper.Replace(dir.Path), promescaper.Replace(strings.ToLower(lastElement(dir.Path))), dir.Class)
+}
+
+// prometheusMetrics : Render the last processing cycle in Prometheus text format
+func prometheusMetrics(ctx *context, haserror bool) []byte {
+	var out bytes.Buffer
+	keys := make([]string, 0, len(ctx.dirfilesout.Directories))
+	for path, dir := range ctx.dirfilesout.Directories {
+		if *ctx.selectfile == "" || strings.Contains(strings.ToLower(dir.Path), strings.ToLower(*ctx.selectfile)) {
+			keys = append(keys, path)
+		}
+	}
+	sort.Strings(keys)
+	if len(ctx.dirfilesout.Order) > 0 {
+		// -sort/-limit : reported directories only, in report order
+		keys = ctx.dirfilesout.Order
+	}
+	gauge := func(name string, help string, value func(Directory) float64) {
+		fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, key := range keys {
+			dir := ctx.dirfilesout.Directories[key]
+			fmt.Fprintf(&out, "%s{%s} %g\n", name, promLabels(dir), value(dir))
+		}
+	}
+	gauge("bboard_directory_files", "Number of files in the directory", func(d Directory) float64 {
+		return float64(d.Current.Count)
+	})
+	gauge("bboard_directory_delta", "Files count change since the previous refresh", func(d Directory) float64 {
+		if len(d.Histories) == 0 {
+			return 0
+		}
+		return float64(d.Current.Count - d.Histories[len(d.Histories)-1].Count)
+	})
+	gauge("bboard_directory_bytes", "Total size of the files in the directory", func(d Directory) float64 {
+		return float64(d.Current.Bytes)
+	})
+	gauge("bboard_directory_disk_bytes", "Allocated size on disk (tree mode with -diskusage)", func(d Directory) float64 {
+		return float64(d.Current.DiskBytes)
+	})
+	gauge("bboard_directory_oldest_seconds", "Age of the oldest file", func(d Directory) float64 {
+		return d.Current.oldestAge().Seconds()
+	})
+	gauge("bboard_directory_newest_seconds", "Age of the newest file", func(d Directory) float64 {
+		return d.Current.newestAge().Seconds()
+	})
+	gauge("bboard_directory_error", "Directory could not be read by the last refresh", func(d Directory) float64 {
+		if d.Error != "" {
+			return 1
+		}
+		return 0
+	})
+	volume := func(name string, help string, value func(Volume) uint64) {
+		fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, base := range volumeBases(ctx) {
+			fmt.Fprintf(&out, "%s{base=\"%s\"} %d\n", name, promescaper.Replace(base), value(ctx.dirfilesout.Volumes[base]))
+		}
+	}
+	if len(ctx.dirfilesout.Groups) > 0 {
+		names := make([]string, 0, len(ctx.dirfilesout.Groups))
+		for name := range ctx.dirfilesout.Groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		group := func(name string, help string, value func(Directory) float64) {
+			fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+			for _, key := range names {
+				g := ctx.dirfilesout.Groups[key]
+				fmt.Fprintf(&out, "%s{group=\"%s\",class=\"%s\"} %g\n", name, promescaper.Replace(key), g.Class, value(g))
+			}
+		}
+		group("bboard_group_files", "Number of files in the directories of the group", func(g Directory) float64 { return float64(g.Current.Count) })
+		group("bboard_group_bytes", "Total size of the files in the directories of the group", func(g Directory) float64 { return float64(g.Current.Bytes) })
+		group("bboard_group_oldest_seconds", "Age of the oldest file of the group", func(g Directory) float64 { return g.Current.oldestAge().Seconds() })
+	}
+	if len(ctx.dirfilesout.Volumes) > 0 {
+		volume("bboard_volume_size_bytes", "Size of the filesystem holding the base", func(v Volume) uint64 { return v.Total })
+		volume("bboard_volume_used_bytes", "Used bytes of the filesystem holding the base", func(v Volume) uint64 { return v.Used })
+		volume("bboard_volume_free_bytes", "Free bytes of the filesystem holding the base", func(v Volume) uint64 { return v.Free })
+		volume("bboard_volume_avail_bytes", "Free bytes available to non privileged users", func(v Volume) uint64 { return v.Avail })
+		volume("bboard_volume_files", "Inodes of the filesystem holding the base", func(v Volume) uint64 { return v.Files })
+		volume("bboard_volume_files_free", "Free inodes of the filesystem holding the base", func(v Volume) uint64 { return v.FilesFree })
+	}
+	fmt.Fprintf(&out, "# HELP bboard_age_basis Timestamp used for files age (-age-by)\n# TYPE bboard_age_basis gauge\nbboard_age_basis{basis=%q} 1\n", *ctx.ageby)
+	scanerror := 0
+	if haserror {
+		scanerror = 1
+	}
+	fmt.Fprintf(&out, "# HELP bboard_scan_duration_seconds Duration of the last refresh\n# TYPE bboard_scan_duration_seconds gauge\nbboard_scan_duration_seconds %g\n", ctx.endtime.Sub(ctx.starttime).Seconds())
+	fmt.Fprintf(&out, "# HELP bboard_scan_files Files seen by the last refresh\n# TYPE bboard_scan_files gauge\nbboard_scan_files %d\n", ctx.filecount)
+	fmt.Fprintf(&out, "# HELP bboard_scan_directories Directories seen by the last refresh\n# TYPE bboard_scan_directories gauge\nbboard_scan_directories %d\n", ctx.dircount)
+	fmt.Fprintf(&out, "# HELP bboard_scan_error Last refresh had a process error\n# TYPE bboard_scan_error gauge\nbboard_scan_error %d\n", scanerror)
+	return out.Bytes()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func init() {
+	backends["sftp"] = openSFTP
+}
+
+// sftpFS : Directories of a SFTP server, one ssh connection per host for the run
+type sftpFS struct {
+	remoteConn
+	prefix string
+	client *sftp.Client
+}
+
+// sshCloser : Close the ssh connection first, so the sftp session does not wait for a dead server
+type sshCloser struct {
+	client *sftp.Client
+	conn   *ssh.Client
+}
+
+func (c sshCloser) Close() error {
+	err := c.conn.Close()
+	c.client.Close()
+	return err
+}
+
+// openSFTP : sftp://[user@]host[:port]/path/
+func openSFTP(ctx *context, location string) (FileSystem, string, error) {
+	user, host, path, err := remoteLocation(location, "22")
+	if err != nil {
+		return nil, "", err
+	}
+	prefix := remotePrefix("sftp", user, host)
+	fsys, err := mountFS(ctx, prefix, func() (FileSystem, error) {
+		source := remoteSource(ctx, "sftp", user, host, "22")
+		config, err := sshConfig(source)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := sshDial(host, config)
+		if err != nil {
+			return nil, err
+		}
+		client, err := sftp.NewClient(conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return &sftpFS{
+			remoteConn: remoteConn{timeout: time.Duration(source.Timeout) * time.Second, closer: sshCloser{client: client, conn: conn}},
+			prefix:     prefix,
+			client:     client,
+		}, nil
+	})
+	return fsys, path, err
+}
+
+// sshDial : ssh.Dial with the timeout applied to the handshake too
+func sshDial(host string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	nc, err := net.DialTimeout("tcp", host, config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	nc.SetDeadline(time.Now().Add(config.Timeout))
+	c, chans, reqs, err := ssh.NewClientConn(nc, host, config)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// sshConfig : Password and/or private key authentication, host key checked with known_hosts
+func sshConfig(source Source) (*ssh.ClientConfig, error) {
+	config := &ssh.ClientConfig{User: source.User, Timeout: time.Duration(source.Timeout) * time.Second}
+	if source.KeyFile != "" {
+		key, err := ioutil.ReadFile(source.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		var signer ssh.Signer
+		if source.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(source.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("private key %s: %v", source.KeyFile, err)
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+	if source.Password != "" {
+		config.Auth = append(config.Auth, ssh.Password(source.Password))
+	}
+	if source.InsecureHostKey {
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		return config, nil
+	}
+	known := source.KnownHosts
+	if known == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		known = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(known)
+	if err != nil {
+		return nil, fmt.Errorf("known hosts %s: %v", known, err)
+	}
+	config.HostKeyCallback = callback
+	return config, nil
+}
+
+func (s *sftpFS) ReadDir(path string) ([]os.FileInfo, error) {
+	var files []os.FileInfo
+	err := s.do(func() (err error) {
+		files, err = s.client.ReadDir(path)
+		return err
+	})
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: s.prefix + path, Err: err}
+	}
+	return files, nil
+}
+
+func (s *sftpFS) Stat(path string) (os.FileInfo, error) {
+	var info os.FileInfo
+	err := s.do(func() (err error) {
+		info, err = s.client.Lstat(path)
+		return err
+	})
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: s.prefix + path, Err: err}
+	}
+	return info, nil
+}
+
+func (s *sftpFS) Separator() string {
+	return "/"
+}
+
+func (s *sftpFS) Prefix() string {
+	return s.prefix
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// pipeSFTP : SFTP client of an in-process server on the local disk, read only
+func pipeSFTP(t *testing.T) *sftpFS {
+	client, server := net.Pipe()
+	s, err := sftp.NewServer(server, sftp.ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve()
+	c, err := sftp.NewClientPipe(client, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &sftpFS{remoteConn: remoteConn{timeout: 5 * time.Second, closer: c}, prefix: "sftp://fake:22", client: c}
+	t.Cleanup(func() {
+		f.Close()
+		s.Close()
+	})
+	return f
+}
+
+func TestSFTP(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sftp server paths are unix paths")
+	}
+	dir := filepath.ToSlash(t.TempDir())
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for name, size := range map[string]int{"in/a.csv": 10, "in/b.csv": 20, "in/sub/c.csv": 30} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mtime, mtime)
+	}
+	f := pipeSFTP(t)
+
+	files, err := f.ReadDir(dir + "/in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]os.FileInfo{}
+	for _, file := range files {
+		names[file.Name()] = file
+	}
+	if len(names) != 3 || names["a.csv"].Size() != 10 || !names["a.csv"].ModTime().Equal(mtime) || !names["sub"].IsDir() {
+		t.Errorf("ReadDir %v", names)
+	}
+	if info, err := f.Stat(dir + "/in/sub/c.csv"); err != nil || info.IsDir() || info.Size() != 30 {
+		t.Errorf("Stat of a file: %v %v", info, err)
+	}
+	if _, err := f.Stat(dir + "/in/missing"); err == nil || !os.IsNotExist(err.(*os.PathError).Err) {
+		t.Errorf("Stat of a missing file: %v", err)
+	}
+	if _, err := f.ReadDir(dir + "/missing"); err == nil {
+		t.Errorf("ReadDir of a missing directory succeeded")
+	}
+
+	// Tree walk of a remote directory
+	ctx := testContext("tree")
+	stat, _ := walkincremental(ctx, f, dir+"/in", nil)
+	if stat.Count != 3 || stat.Bytes != 60 {
+		t.Errorf("tree walk: %d files %d bytes", stat.Count, stat.Bytes)
+	}
+
+	f.Close()
+	if _, err := f.ReadDir(dir + "/in"); err == nil || f.Alive() {
+		t.Errorf("ReadDir after close: %v", err)
+	}
+}
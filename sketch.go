@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// sketchAccuracy : Relative error of the quantiles (logarithmic buckets, DDSketch like)
+// Memory is bounded by sketchMaxBuckets whatever the files count
+const (
+	sketchAccuracy   = 0.01
+	sketchMaxBuckets = 2048
+)
+
+var sketchLogGamma = math.Log((1 + sketchAccuracy) / (1 - sketchAccuracy))
+
+// sketch : Streaming quantiles of positive values
+type sketch struct {
+	buckets map[int]int64
+	zeros   int64
+	count   int64
+	sum     float64
+}
+
+func newSketch() sketch {
+	return sketch{buckets: map[int]int64{}}
+}
+
+func (s *sketch) add(value float64) {
+	s.count++
+	s.sum = s.sum + value
+	if value < 1 {
+		s.zeros++
+		return
+	}
+	s.buckets[int(math.Ceil(math.Log(value)/sketchLogGamma))]++
+	if len(s.buckets) > sketchMaxBuckets {
+		s.collapse()
+	}
+}
+
+// collapse : Merge the lowest bucket into the next one, high quantiles stay accurate
+func (s *sketch) collapse() {
+	keys := s.keys()
+	s.buckets[keys[1]] = s.buckets[keys[1]] + s.buckets[keys[0]]
+	delete(s.buckets, keys[0])
+}
+
+func (s *sketch) keys() []int {
+	keys := make([]int, 0, len(s.buckets))
+	for k := range s.buckets {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// quantile : Value at rank q (0..1), middle of the bucket holding that rank
+func (s *sketch) quantile(q float64) float64 {
+	rank := int64(q * float64(s.count-1))
+	seen := s.zeros
+	if rank < seen {
+		return 0
+	}
+	for _, k := range s.keys() {
+		seen = seen + s.buckets[k]
+		if rank < seen {
+			gamma := math.Exp(sketchLogGamma)
+			return 2 * math.Pow(gamma, float64(k)) / (gamma + 1)
+		}
+	}
+	return 0
+}
+
+// Summary : Distribution of a value in a directory (-stats)
+type Summary struct {
+	Mean   int64
+	Median int64
+	P90    int64
+	P99    int64
+}
+
+// influxFields : ,<name>_mean=..i,<name>_median=..i,<name>_p90=..i,<name>_p99=..i
+func (s *Summary) influxFields(name string) string {
+	return fmt.Sprintf(",%s_mean=%di,%s_median=%di,%s_p90=%di,%s_p99=%di", name, s.Mean, name, s.Median, name, s.P90, name, s.P99)
+}
+
+func (s *sketch) summary() *Summary {
+	if s.count == 0 {
+		return nil
+	}
+	return &Summary{
+		Mean:   int64(math.Round(s.sum / float64(s.count))),
+		Median: int64(math.Round(s.quantile(0.5))),
+		P90:    int64(math.Round(s.quantile(0.9))),
+		P99:    int64(math.Round(s.quantile(0.99))),
+	}
+}
+
+// sketches : File sizes (bytes) and ages (seconds at scan time) of a directory being walked
+type sketches struct {
+	sizes sketch
+	ages  sketch
+}
+
+func newSketches() *sketches {
+	return &sketches{sizes: newSketch(), ages: newSketch()}
+}
+
+func (k *sketches) add(size int64, age time.Duration) {
+	if age < 0 {
+		age = 0
+	}
+	k.sizes.add(float64(size))
+	k.ages.add(age.Seconds())
+}
+
+// summarize : Replace the sketches of a walked directory by their summaries
+func (s Stat) summarize() Stat {
+	if s.sketch != nil {
+		s.Sizes, s.Ages = s.sketch.sizes.summary(), s.sketch.ages.summary()
+		s.sketch = nil
+	}
+	return s
+}
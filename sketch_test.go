@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// The sketch quantiles stay within sketchAccuracy of the exact values, same rank convention
+func TestSketchQuantiles(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name  string
+		value func(i int) float64
+	}{
+		{"uniform sizes", func(i int) float64 { return float64(1 + random.Intn(1000000)) }},
+		{"lognormal sizes", func(i int) float64 { return math.Ceil(math.Exp(8 + 2*random.NormFloat64())) }},
+		{"exponential ages", func(i int) float64 { return math.Floor(random.ExpFloat64() * 86400) }},
+		{"mostly empty files", func(i int) float64 {
+			if i%3 == 0 {
+				return float64(1 + random.Intn(100))
+			}
+			return 0
+		}},
+		// More buckets than sketchMaxBuckets : the lowest ones are merged, high quantiles stay accurate
+		{"collapsed buckets", func(i int) float64 { return math.Pow(10, 19*random.Float64()) }},
+	}
+	for _, test := range tests {
+		s := newSketch()
+		values := make([]float64, 100000)
+		for i := range values {
+			values[i] = test.value(i)
+			s.add(values[i])
+		}
+		if len(s.buckets) > sketchMaxBuckets {
+			t.Errorf("%s: %d buckets", test.name, len(s.buckets))
+		}
+		sort.Float64s(values)
+		for _, q := range []float64{0.5, 0.9, 0.99} {
+			exact := values[int(q*float64(len(values)-1))]
+			got := s.quantile(q)
+			if exact < 1 && got != 0 || exact >= 1 && math.Abs(got-exact) > sketchAccuracy*exact {
+				t.Errorf("%s: p%v %v, exact %v", test.name, q*100, got, exact)
+			}
+		}
+	}
+}
+
+func TestSketchSummary(t *testing.T) {
+	s := newSketch()
+	if s.summary() != nil {
+		t.Errorf("summary of an empty sketch")
+	}
+	for _, value := range []float64{10, 20, 30, 1000} {
+		s.add(value)
+	}
+	if summary := s.summary(); summary.Mean != 265 || summary.Median != 20 || summary.P90 != 30 || summary.P99 != 30 {
+		t.Errorf("summary %+v", summary)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// reportEntry : Directory of the report, classified before being sorted
+type reportEntry struct {
+	path      string
+	dir       Directory
+	highlight bool
+	class     string
+	trend     string
+	delta     int
+}
+
+// sortkeys : -sort keys, ascending order. Ties are ordered by path
+var sortkeys = map[string]func(a reportEntry, b reportEntry) bool{
+	"path":  func(a, b reportEntry) bool { return false },
+	"count": func(a, b reportEntry) bool { return a.dir.Current.Count < b.dir.Current.Count },
+	"delta": func(a, b reportEntry) bool { return a.delta < b.delta },
+	"size":  func(a, b reportEntry) bool { return a.dir.Current.Bytes < b.dir.Current.Bytes },
+	"age":   func(a, b reportEntry) bool { return a.dir.Current.oldestAge() < b.dir.Current.oldestAge() },
+	"class": func(a, b reportEntry) bool { return a.class < b.class },
+}
+
+// parseSort : -sort key[:asc|:desc]
+func parseSort(value string) (string, bool, error) {
+	key, order := value, "asc"
+	if i := strings.Index(value, ":"); i >= 0 {
+		key, order = value[:i], value[i+1:]
+	}
+	if _, ok := sortkeys[key]; !ok || (order != "asc" && order != "desc") {
+		return "", false, fmt.Errorf("invalid -sort %q, expected path, count, delta, size, age or class, with :asc or :desc", value)
+	}
+	return key, order == "desc", nil
+}
+
+// sortEntries : Report order of the directories (-sort)
+func sortEntries(ctx *context, entries []reportEntry) {
+	key, desc, _ := parseSort(*ctx.sortby)
+	orderEntries(entries, key, desc)
+}
+
+// orderEntries : Sort entries on a -sort key
+func orderEntries(entries []reportEntry, key string, desc bool) {
+	less := sortkeys[key]
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if desc {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		} else if less(b, a) {
+			return false
+		}
+		return entries[i].path < entries[j].path
+	})
+}
+
+// delta : Files count change since the previous run
+func (d Directory) delta() int {
+	if len(d.Histories) == 0 {
+		return 0
+	}
+	return d.Current.Count - d.Histories[len(d.Histories)-1].Count
+}
+
+// sortedPaths : Directories paths in alphabetical order
+func sortedPaths(dirs map[string]Directory) []string {
+	paths := make([]string, 0, len(dirs))
+	for path := range dirs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TreeDir : Tree mode - files directly in a subdirectory of a walked tree
+// Kept in the cache with -incremental, reused by the next run while the directory mtime is unchanged (no file added, removed or renamed)
+type TreeDir struct {
+	Mtime time.Time
+	Dirs  []string `json:",omitempty"` // Subdirectories names
+	Files Stat
+}
+
+// treeWalker : Walk of one tree, subdirectory by subdirectory
+type treeWalker struct {
+	ctx    *context
+	fsys   FileSystem
+	base   string
+	seen   map[fileID]bool
+	sketch *sketches          // -stats, shared by the directories of the tree
+	prev   map[string]TreeDir // previous run, nil for a full walk
+	dirs   map[string]TreeDir // by path relative to base, "" for base
+	read   int
+	reused int
+}
+
+// walkDir : Stat of a subtree, from the cache when the directory mtime is unchanged
+// A zero mtime (S3 prefixes, FTP listings) is unknown, the directory is read
+func (t *treeWalker) walkDir(path string, rel string, info os.FileInfo) Stat {
+	if rel != "" {
+		t.ctx.dircount++
+	}
+	cached, ok := t.prev[rel]
+	if !ok || info.ModTime().IsZero() || !cached.Mtime.Equal(info.ModTime()) {
+		return t.readDir(path, rel, info)
+	}
+	// Every subdirectory is checked before any is walked, so a fallback doesn't count them twice
+	subs := make([]os.FileInfo, 0, len(cached.Dirs))
+	for _, name := range cached.Dirs {
+		sub, err := t.fsys.Stat(joinPath(t.fsys, path, name))
+		if err != nil || !sub.IsDir() {
+			// A subdirectory was replaced without changing the parent mtime
+			return t.readDir(path, rel, info)
+		}
+		subs = append(subs, sub)
+	}
+	stat := cached.Files
+	stat.Scanned = t.ctx.starttime
+	for i, name := range cached.Dirs {
+		stat = stat.merge(t.walkDir(joinPath(t.fsys, path, name), rel+t.fsys.Separator()+name, subs[i]))
+	}
+	t.dirs[rel] = cached
+	t.reused++
+	return stat
+}
+
+// readDir : Read the files of a directory and walk its subdirectories
+func (t *treeWalker) readDir(path string, rel string, info os.FileInfo) Stat {
+	ctx := t.ctx
+	stat := Stat{Count: 0, Scanned: ctx.starttime, sketch: t.sketch}
+	files, err := t.fsys.ReadDir(path)
+	if err != nil {
+		if *ctx.errors != "" {
+			if _, err := io.WriteString(ctx.errorsout, fmt.Sprintf("prevent panic by handling failure accessing a path %q: %s - %v\n", t.base, path, err)); err != nil {
+				fmt.Printf("unable to log error on %q: %s, %v\n", t.base, path, err)
+				exit(1)
+			}
+		} else {
+			fmt.Fprintf(consoleOut(ctx), "Error %q: %s, %v\n", t.base, path, err)
+		}
+		delete(t.dirs, rel)
+		return stat
+	}
+	t.read++
+	dirs := []string{}
+	subdirs := []os.FileInfo{}
+	for _, file := range files {
+		if file.IsDir() {
+			dirs = append(dirs, file.Name())
+			subdirs = append(subdirs, file)
+			continue
+		}
+		stat = stat.registerEntry(ctx, t.fsys, t.seen, joinPath(t.fsys, path, file.Name()), file)
+	}
+	t.dirs[rel] = TreeDir{Mtime: info.ModTime(), Dirs: dirs, Files: stat}
+	// The listing gives the subdirectories mtime, no Stat round trip (remote sources)
+	for _, sub := range subdirs {
+		stat = stat.merge(t.walkDir(joinPath(t.fsys, path, sub.Name()), rel+t.fsys.Separator()+sub.Name(), sub))
+	}
+	return stat
+}
+
+// walkincremental : Tree walk keeping the files of each subdirectory (hierarchy, next run with -incremental)
+// prev is nil for a full walk. Hard linked files are counted once among the directories read
+func walkincremental(ctx *context, fsys FileSystem, base string, prev map[string]TreeDir) (Stat, map[string]TreeDir) {
+	t := &treeWalker{ctx: ctx, fsys: fsys, base: base, seen: map[fileID]bool{}, prev: prev, dirs: map[string]TreeDir{}}
+	if *ctx.stats {
+		t.sketch = newSketches()
+	}
+	info, err := fsys.Stat(base)
+	if err != nil {
+		fmt.Fprintf(consoleOut(ctx), "error walking the path %q: %v\n", base, err)
+		return Stat{Count: 0, Scanned: ctx.starttime, sketch: t.sketch}, nil
+	}
+	stat := t.walkDir(base, "", info)
+	if *ctx.verbose {
+		fmt.Printf("Tree %s : %d directories read, %d reused\n", base, t.read, t.reused)
+	}
+	return stat, t.dirs
+}
+
+// TreeNode : Tree mode hierarchy - count and size of a directory subtree, children by decreasing size (-nested)
+type TreeNode struct {
+	Name      string
+	Path      string `json:",omitempty"` // Walked directories only
+	Count     int
+	Bytes     int64
+	DiskBytes int64      `json:",omitempty"`
+	Percent   float64    // Of the parent bytes
+	Files     int        // Files directly in the directory
+	Children  []TreeNode `json:",omitempty"`
+}
+
+// buildTree : Hierarchy of a walked directory from its subdirectories files
+func buildTree(dirs map[string]TreeDir, sep string, rel string, name string) TreeNode {
+	dir := dirs[rel]
+	node := TreeNode{Name: name, Count: dir.Files.Count, Bytes: dir.Files.Bytes, DiskBytes: dir.Files.DiskBytes, Files: dir.Files.Count}
+	for _, sub := range dir.Dirs {
+		if _, ok := dirs[rel+sep+sub]; !ok {
+			// Not readable
+			continue
+		}
+		child := buildTree(dirs, sep, rel+sep+sub, sub)
+		node.Count = node.Count + child.Count
+		node.Bytes = node.Bytes + child.Bytes
+		node.DiskBytes = node.DiskBytes + child.DiskBytes
+		node.Children = append(node.Children, child)
+	}
+	for i := range node.Children {
+		if node.Bytes > 0 {
+			node.Children[i].Percent = float64(node.Children[i].Bytes) * 100 / float64(node.Bytes)
+		}
+	}
+	sort.SliceStable(node.Children, func(i, j int) bool {
+		if node.Children[i].Bytes != node.Children[j].Bytes {
+			return node.Children[i].Bytes > node.Children[j].Bytes
+		}
+		return node.Children[i].Name < node.Children[j].Name
+	})
+	return node
+}
+
+// treeOf : Hierarchy of a walked directory, nil when it was not walked (replay, unreadable)
+func treeOf(ctx *context, path string) *TreeNode {
+	dirs, ok := ctx.trees[path]
+	if !ok {
+		dirs, ok = ctx.dirfilesout.Directories[path].Subdirs, len(ctx.dirfilesout.Directories[path].Subdirs) > 0
+	}
+	if !ok || dirs == nil {
+		return nil
+	}
+	// Remote and archive filesystems use slashes
+	sep := string(os.PathSeparator)
+	if strings.Contains(path, "://") {
+		sep = "/"
+	}
+	node := buildTree(dirs, sep, "", lastElement(path))
+	node.Path, node.Percent = path, 100
+	return &node
+}
+
+// saveNested : Write the hierarchy of the walked directories, in the report order (-nested)
+func saveNested(ctx *context) error {
+	if *ctx.nested == "" || !*ctx.flagtree {
+		return nil
+	}
+	nodes := []TreeNode{}
+	for _, entry := range ctx.report {
+		if node := treeOf(ctx, entry.path); node != nil {
+			nodes = append(nodes, *node)
+		}
+	}
+	nested, err := json.MarshalIndent(nodes, "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*ctx.nested, nested, 0644)
+}
+
+// merge : Add the stat of a subtree (tree mode, LessBytes and MoreBytes are sums)
+func (s Stat) merge(o Stat) Stat {
+	if o.Count > 0 {
+		if s.Count == 0 || o.Oldest.Before(s.Oldest) {
+			s.Oldest, s.MsFile = o.Oldest, o.MsFile
+		}
+		if s.Count == 0 || o.Newest.After(s.Newest) {
+			s.Newest, s.LsFile = o.Newest, o.LsFile
+		}
+	}
+	if o.Entries > 0 {
+		if s.Entries == 0 || o.EntryOldest.Before(s.EntryOldest) {
+			s.EntryOldest = o.EntryOldest
+		}
+		if s.Entries == 0 || o.EntryNewest.After(s.EntryNewest) {
+			s.EntryNewest = o.EntryNewest
+		}
+	}
+	s.Count = s.Count + o.Count
+	s.Bytes = s.Bytes + o.Bytes
+	s.DiskBytes = s.DiskBytes + o.DiskBytes
+	s.LessBytes = s.LessBytes + o.LessBytes
+	s.MoreBytes = s.MoreBytes + o.MoreBytes
+	s.Archives = s.Archives + o.Archives
+	s.ArchiveBytes = s.ArchiveBytes + o.ArchiveBytes
+	s.Entries = s.Entries + o.Entries
+	s.EntryBytes = s.EntryBytes + o.EntryBytes
+	s.WorldWritable = s.WorldWritable + o.WorldWritable
+	s.Unreadable = s.Unreadable + o.Unreadable
+	s.AgeFallback = s.AgeFallback + o.AgeFallback
+	s.Owners = mergeUsages(s.Owners, o.Owners)
+	s.Groups = mergeUsages(s.Groups, o.Groups)
+	return s
+}
+
+// mergeUsages : Sum of two usage maps, the cached maps are not modified
+func mergeUsages(a map[string]Usage, b map[string]Usage) map[string]Usage {
+	if len(b) == 0 {
+		return a
+	}
+	sum := make(map[string]Usage, len(a)+len(b))
+	for name, u := range a {
+		sum[name] = u
+	}
+	for name, u := range b {
+		sum[name] = Usage{Count: sum[name].Count + u.Count, Bytes: sum[name].Bytes + u.Bytes}
+	}
+	return sum
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testContext : Context of a command with its default flags
+func testContext(command string, args ...string) *context {
+	ctx := &context{command: command, starttime: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	flags := flag.NewFlagSet("bboard "+command, flag.ContinueOnError)
+	setFlagList(ctx, flags)
+	if err := flags.Parse(args); err != nil {
+		panic(err)
+	}
+	return ctx
+}
+
+// treeFS : /data tree, each file gives its mtime to the directories it creates
+func treeFS(files map[string]time.Time) *memFS {
+	fsys := newMemFS("mem://")
+	for _, name := range []string{"/data/a", "/data/w/d", "/data/x/b", "/data/x/y/c"} {
+		if mtime, ok := files[name]; ok {
+			fsys.add(name, memInfo{size: int64(len(name)), mode: 0444, mtime: mtime})
+		}
+	}
+	return fsys
+}
+
+func TestWalkIncremental(t *testing.T) {
+	m1, m2 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	all := map[string]time.Time{"/data/a": m1, "/data/w/d": m1, "/data/x/b": m1, "/data/x/y/c": m1}
+	ctx := testContext("tree", "-incremental", "24h")
+
+	stat, dirs := walkincremental(ctx, treeFS(all), "/data", nil)
+	if stat.Count != 4 || stat.Bytes != 7+9+9+11 || ctx.filecount != 4 || len(dirs) != 4 {
+		t.Fatalf("full walk: %d files %d bytes, %d registered, %d directories", stat.Count, stat.Bytes, ctx.filecount, len(dirs))
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]time.Time
+		count   int
+		bytes   int64
+		read    uint64 // files registered again
+		reusedY bool
+	}{
+		{"unchanged", all, 4, 36, 0, true},
+		{"changed subdirectory", map[string]time.Time{"/data/a": m1, "/data/w/d": m2, "/data/x/b": m1, "/data/x/y/c": m1}, 4, 36, 1, true},
+		{"zero mtimes are read", map[string]time.Time{"/data/a": {}, "/data/w/d": {}, "/data/x/b": {}, "/data/x/y/c": {}}, 4, 36, 4, false},
+		// x removed without changing the /data mtime, w changed : walked once, not again by the fallback
+		{"removed subdirectory", map[string]time.Time{"/data/a": m1, "/data/w/d": m2}, 2, 16, 2, false},
+	}
+	for _, test := range tests {
+		ctx.filecount = 0
+		stat, next := walkincremental(ctx, treeFS(test.files), "/data", dirs)
+		if stat.Count != test.count || stat.Bytes != test.bytes || ctx.filecount != test.read {
+			t.Errorf("%s: %d files %d bytes, %d registered, want %d %d %d", test.name, stat.Count, stat.Bytes, ctx.filecount, test.count, test.bytes, test.read)
+		}
+		if _, ok := next["/x/y"]; test.reusedY && !ok {
+			t.Errorf("%s: /x/y not kept", test.name)
+		}
+	}
+}
+
+func TestBuildTree(t *testing.T) {
+	ctx := testContext("tree")
+	_, dirs := walkincremental(ctx, treeFS(map[string]time.Time{"/data/a": {}, "/data/w/d": {}, "/data/x/b": {}, "/data/x/y/c": {}}), "/data", nil)
+	root := buildTree(dirs, "/", "", "data")
+	if root.Count != 4 || root.Bytes != 36 || root.Files != 1 || len(root.Children) != 2 {
+		t.Fatalf("root %+v", root)
+	}
+	x, w := root.Children[0], root.Children[1]
+	if x.Name != "x" || x.Bytes != 20 || x.Files != 1 || w.Name != "w" || w.Bytes != 9 {
+		t.Errorf("children by size: %s %d, %s %d", x.Name, x.Bytes, w.Name, w.Bytes)
+	}
+	if x.Percent != float64(20)*100/36 || x.Children[0].Percent != 55 {
+		t.Errorf("percent of parent: %v %v", x.Percent, x.Children[0].Percent)
+	}
+}
+
+// A look directory nested in a walked subtree is part of its stat, whichever walker runs
+func TestNestedLook(t *testing.T) {
+	fsys := newMemFS("mem://")
+	for name, size := range map[string]int64{"/data/in/f0": 1, "/data/in/x/f1": 10, "/data/in/x/in/y/f2": 20, "/data/in/z/f3": 30, "/data/out/f4": 40} {
+		fsys.add(name, memInfo{size: size, mode: 0444})
+	}
+	reports := []map[string]int64{}
+	for _, args := range [][]string{{}, {"-incremental", "24h"}} {
+		ctx := testContext("tree", args...)
+		initDataArea(ctx)
+		if err := getFilesInPath(ctx, fsys, "/data/", "in"); err != nil {
+			t.Fatal(err)
+		}
+		report := map[string]int64{}
+		for path, d := range ctx.dirfilesout.Directories {
+			report[path] = d.Current.Bytes
+		}
+		reports = append(reports, report)
+		if ctx.filecount != 5 {
+			t.Errorf("%v: %d files processed", args, ctx.filecount)
+		}
+	}
+	want := map[string]int64{"mem:///data/in": 0, "mem:///data/in/x": 30, "mem:///data/in/z": 30}
+	for i, report := range reports {
+		if !reflect.DeepEqual(report, want) {
+			t.Errorf("walker %d: %v want %v", i, report, want)
+		}
+	}
+}
@@ -0,0 +1,609 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/gdamore/tcell/v2"
+)
+
+// tuicolors : terminal color of each highlighted class, same as the console classcolors
+var tuicolors = map[string]tcell.Color{
+	"empty":    tcell.ColorLime,
+	"recent":   tcell.ColorYellow,
+	"increase": tcell.ColorFuchsia,
+	"flat":     tcell.ColorWhite,
+	"error":    tcell.ColorRed,
+	"anomaly":  tcell.ColorAqua,
+}
+
+// tuicolumns : Directories table, the key selects the column with its -sort key
+var tuicolumns = []struct {
+	title string
+	key   string
+	width int // 0: remaining width
+	value func(e reportEntry) string
+}{
+	{"Files", "count", 9, func(e reportEntry) string { return fmt.Sprintf("%9d", e.dir.Current.Count) }},
+	{"Delta", "delta", 9, func(e reportEntry) string { return fmt.Sprintf("%+9d", e.delta) }},
+	{"Size", "size", 10, func(e reportEntry) string { return fmt.Sprintf("%10s", humanize.Bytes(uint64(e.dir.Current.Bytes))) }},
+	{"Oldest", "age", 18, func(e reportEntry) string {
+		if e.dir.Current.Count == 0 {
+			return ""
+		}
+		return humanizeMinutes(int(e.dir.Current.oldestAge().Minutes()))
+	}},
+	{"Class", "class", 9, func(e reportEntry) string { return e.class }},
+	{"Path", "path", 0, func(e reportEntry) string { return e.path }},
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline : One block per value, scaled between the lowest and the highest value
+func sparkline(values []int64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	low, high := values[0], values[0]
+	for _, v := range values {
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+	}
+	line := make([]rune, len(values))
+	for i, v := range values {
+		line[i] = sparks[0]
+		if high > low {
+			line[i] = sparks[int((v-low)*int64(len(sparks)-1)/(high-low))]
+		}
+	}
+	return string(line)
+}
+
+// tui : Interactive view of the last report. The scan runs in background, its console output is the progress line
+type tui struct {
+	ctx      *context
+	screen   tcell.Screen
+	lock     sync.Mutex
+	running  bool
+	quitting bool
+	started  time.Time
+	progress string
+	err      error
+	entries  []reportEntry // last report
+	rows     []reportEntry // shown entries : filtered and sorted
+	key      string
+	desc     bool
+	filter   string
+	editing  bool
+	selected int
+	top      int
+	trees    map[string]*TreeNode // tui -tree - hierarchy of each walked directory
+	levels   []level              // expanded directories, the table is shown when empty
+}
+
+// level : Directory expanded in the tree browser, with its cursor
+type level struct {
+	node     *TreeNode
+	path     string
+	selected int
+	top      int
+}
+
+// runTui : tui command - scan, then browse the directories until quit
+func runTui(ctx *context) error {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+	if err := screen.Init(); err != nil {
+		return err
+	}
+	defer screen.Fini()
+	// The scan goroutine restores the terminal before exiting (see scan)
+	exit = func(code int) { panic(tuiExit(code)) }
+	defer func() { exit = os.Exit }()
+	// Console output is read from a pipe, colors would be written to the terminal
+	color.NoColor = true
+	if *ctx.feedback == 0 {
+		*ctx.feedback = 1000
+	}
+	t := &tui{ctx: ctx, screen: screen, filter: *ctx.selectfile}
+	t.key, t.desc, _ = parseSort(*ctx.sortby)
+	t.scan()
+	for {
+		t.draw()
+		switch ev := screen.PollEvent().(type) {
+		case *tcell.EventResize:
+			screen.Sync()
+		case *tcell.EventKey:
+			if !t.keypressed(ev) {
+				return nil
+			}
+		}
+	}
+}
+
+// tuiExit : exit code of a processing stopped by a failed write, the scan goroutine leaves once the terminal is restored
+type tuiExit int
+
+// scan : One processing cycle in background, stdout is followed as the progress line
+// Called before the events loop, then by keypressed with the lock held
+func (t *tui) scan() {
+	t.running, t.started, t.progress, t.err = true, time.Now(), "", nil
+	go func() {
+		stdout := os.Stdout
+		followed := make(chan bool)
+		r, w, err := os.Pipe()
+		if err == nil {
+			os.Stdout = w
+			go func() {
+				t.follow(r)
+				close(followed)
+			}()
+		} else {
+			close(followed)
+		}
+		done := make(chan bool)
+		go t.tick(done)
+		defer func() {
+			if failure := recover(); failure != nil {
+				// Raw mode would stay after an exit or a panic, the last line written tells why
+				os.Stdout = stdout
+				if w != nil {
+					w.Close()
+				}
+				<-followed
+				t.screen.Fini()
+				t.lock.Lock()
+				fmt.Fprintln(os.Stderr, t.progress)
+				t.lock.Unlock()
+				if code, ok := failure.(tuiExit); ok {
+					os.Exit(int(code))
+				}
+				panic(failure)
+			}
+		}()
+		_, err = runOnce(t.ctx)
+		close(done)
+		if w != nil {
+			os.Stdout = stdout
+			w.Close()
+		}
+		trees := map[string]*TreeNode{}
+		if *t.ctx.flagtree {
+			for _, entry := range t.ctx.report {
+				trees[entry.path] = treeOf(t.ctx, entry.path)
+			}
+		}
+		t.lock.Lock()
+		t.running, t.err = false, err
+		t.entries, t.trees, t.levels = t.ctx.report, trees, nil
+		t.refilter()
+		t.lock.Unlock()
+		t.screen.PostEvent(tcell.NewEventInterrupt(nil))
+	}()
+}
+
+// follow : Last line written on stdout during the scan (feedback, processed directories)
+func (t *tui) follow(r *os.File) {
+	defer r.Close()
+	lines := bufio.NewScanner(r)
+	lines.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	for lines.Scan() {
+		if line := strings.TrimSpace(lines.Text()); line != "" {
+			t.lock.Lock()
+			t.progress = line
+			t.lock.Unlock()
+		}
+	}
+}
+
+// tick : Redraw the progress while the scan runs
+func (t *tui) tick(done chan bool) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			t.screen.PostEvent(tcell.NewEventInterrupt(nil))
+		}
+	}
+}
+
+// refilter : Shown entries - -filternull, filter (contains, as -select), sort and -limit. The selected path is kept
+func (t *tui) refilter() {
+	path := ""
+	if t.selected < len(t.rows) {
+		path = t.rows[t.selected].path
+	}
+	t.rows = t.rows[:0]
+	for _, e := range t.entries {
+		if *t.ctx.filter0 && !e.highlight {
+			continue
+		}
+		if t.filter != "" && !strings.Contains(strings.ToLower(e.dir.Path), strings.ToLower(t.filter)) {
+			continue
+		}
+		t.rows = append(t.rows, e)
+	}
+	orderEntries(t.rows, t.key, t.desc)
+	if *t.ctx.limit > 0 && len(t.rows) > *t.ctx.limit {
+		t.rows = t.rows[:*t.ctx.limit]
+	}
+	t.selected = 0
+	for i, e := range t.rows {
+		if e.path == path {
+			t.selected = i
+		}
+	}
+}
+
+// keypressed : Navigation, sort, filter and refresh keys. False to quit
+func (t *tui) keypressed(ev *tcell.EventKey) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.editing {
+		switch ev.Key() {
+		case tcell.KeyEnter:
+			t.editing = false
+		case tcell.KeyEscape:
+			t.editing, t.filter = false, ""
+		case tcell.KeyBackspace, tcell.KeyBackspace2:
+			if t.filter != "" {
+				runes := []rune(t.filter)
+				t.filter = string(runes[:len(runes)-1])
+			}
+		case tcell.KeyRune:
+			t.filter = t.filter + string(ev.Rune())
+		}
+		t.refilter()
+		return true
+	}
+	_, height := t.screen.Size()
+	page := t.tableHeight(height)
+	// The cursor moves in the table or in the expanded directory
+	selected, count := &t.selected, len(t.rows)
+	if len(t.levels) > 0 {
+		l := &t.levels[len(t.levels)-1]
+		selected, count = &l.selected, len(l.node.Children)
+	}
+	switch ev.Key() {
+	case tcell.KeyCtrlC:
+		return false
+	case tcell.KeyEscape:
+		if len(t.levels) > 0 {
+			t.levels = t.levels[:len(t.levels)-1]
+			return true
+		}
+		return t.quit()
+	case tcell.KeyUp:
+		*selected--
+	case tcell.KeyDown:
+		*selected++
+	case tcell.KeyPgUp:
+		*selected = *selected - page
+	case tcell.KeyPgDn:
+		*selected = *selected + page
+	case tcell.KeyHome:
+		*selected = 0
+	case tcell.KeyEnd:
+		*selected = count - 1
+	case tcell.KeyEnter, tcell.KeyRight:
+		t.expand()
+	case tcell.KeyLeft, tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(t.levels) > 0 {
+			t.levels = t.levels[:len(t.levels)-1]
+			return true
+		}
+	case tcell.KeyF5:
+		if !t.running {
+			t.scan()
+		}
+	case tcell.KeyRune:
+		switch r := ev.Rune(); {
+		case r == 'q':
+			return t.quit()
+		case r == 'k':
+			*selected--
+		case r == 'j':
+			*selected++
+		case r == 'l':
+			t.expand()
+		case r == 'h':
+			if len(t.levels) > 0 {
+				t.levels = t.levels[:len(t.levels)-1]
+				return true
+			}
+		case r == 'u':
+			if !t.running {
+				t.scan()
+			}
+		case len(t.levels) > 0:
+			// Children are always by decreasing size, no sort nor filter
+		case r == 'r':
+			t.desc = !t.desc
+			t.refilter()
+		case r == '/':
+			t.editing = true
+		case r >= '1' && r < '1'+rune(len(tuicolumns)):
+			key := tuicolumns[r-'1'].key
+			if key == t.key {
+				t.desc = !t.desc
+			} else {
+				t.key, t.desc = key, key != "path"
+			}
+			t.refilter()
+		}
+	}
+	if *selected >= count {
+		*selected = count - 1
+	}
+	if *selected < 0 {
+		*selected = 0
+	}
+	return true
+}
+
+// expand : tui -tree - open the selected directory, children by decreasing size
+func (t *tui) expand() {
+	if len(t.levels) == 0 {
+		if t.selected < len(t.rows) {
+			if node := t.trees[t.rows[t.selected].path]; node != nil {
+				t.levels = append(t.levels, level{node: node, path: node.Path})
+			}
+		}
+		return
+	}
+	l := t.levels[len(t.levels)-1]
+	if l.selected < len(l.node.Children) && len(l.node.Children[l.selected].Children) > 0 {
+		child := &l.node.Children[l.selected]
+		t.levels = append(t.levels, level{node: child, path: l.path + t.separator(l.path) + child.Name})
+	}
+}
+
+// separator : Remote and archive filesystems use slashes
+func (t *tui) separator(path string) string {
+	if strings.Contains(path, "://") {
+		return "/"
+	}
+	return string(os.PathSeparator)
+}
+
+// quit : A running scan is only abandoned at the second request, the cache could be written
+func (t *tui) quit() bool {
+	if t.running && !t.quitting {
+		t.quitting = true
+		return true
+	}
+	return false
+}
+
+// tableHeight : Table rows, the remaining lines are header, columns, details pane and help
+func (t *tui) tableHeight(height int) int {
+	rows := height - 3 - t.paneHeight(height)
+	if rows < 1 {
+		return 1
+	}
+	return rows
+}
+
+func (t *tui) paneHeight(height int) int {
+	if height < 16 {
+		return height / 3
+	}
+	return height/3 + 1
+}
+
+// text : Write a line at x,y, truncated or padded up to width
+func (t *tui) text(x, y, width int, style tcell.Style, value string) {
+	for _, r := range value {
+		if width <= 0 {
+			return
+		}
+		t.screen.SetContent(x, y, r, nil, style)
+		x++
+		width--
+	}
+	for ; width > 0; width-- {
+		t.screen.SetContent(x, y, ' ', nil, style)
+		x++
+	}
+}
+
+func (t *tui) draw() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.screen.Clear()
+	width, height := t.screen.Size()
+	normal := tcell.StyleDefault
+	bar := normal.Reverse(true)
+
+	order := "asc"
+	if t.desc {
+		order = "desc"
+	}
+	header := fmt.Sprintf("bboard V%s - %d/%d directories - sort %s:%s", VersionNum, len(t.rows), len(t.entries), t.key, order)
+	if t.filter != "" || t.editing {
+		header = header + " - filter: " + t.filter
+	}
+	if len(t.levels) > 0 {
+		l := t.levels[len(t.levels)-1]
+		header = fmt.Sprintf("bboard V%s - %s - %d files (%d directly) - %s", VersionNum, l.path, l.node.Count, l.node.Files, humanize.Bytes(uint64(l.node.Bytes)))
+	}
+	if t.running {
+		header = header + fmt.Sprintf(" - scanning %v - %s", time.Since(t.started).Round(time.Second), t.progress)
+	}
+	if t.err != nil {
+		header = header + " - " + t.err.Error()
+	}
+	t.text(0, 0, width, bar, header)
+
+	rows := t.tableHeight(height)
+	var details []string
+	if len(t.levels) > 0 {
+		details = t.drawLevel(width, rows)
+	} else {
+		details = t.drawTable(width, rows)
+	}
+
+	pane := 2 + rows
+	t.text(0, pane, width, bar, "")
+	for i, line := range details {
+		if i+1 >= t.paneHeight(height) {
+			break
+		}
+		t.text(1, pane+1+i, width-1, normal, line)
+	}
+
+	help := "↑↓ move  1-6 sort column  r reverse  / filter  u refresh  q quit"
+	if *t.ctx.flagtree {
+		help = "↑↓ move  → expand  1-6 sort column  r reverse  / filter  u refresh  q quit"
+	}
+	if len(t.levels) > 0 {
+		help = "↑↓ move  → expand  ← back  u refresh  q quit"
+	}
+	if t.editing {
+		help = "filter: " + t.filter + "_  (enter keep, esc clear)"
+	} else if t.quitting && t.running {
+		help = "scan in progress, q again to abandon it"
+	}
+	t.text(0, height-1, width, bar, help)
+	t.screen.Show()
+}
+
+// scroll : First shown row, so that the selected row is visible
+func scroll(selected int, top *int, rows int) {
+	if selected < *top {
+		*top = selected
+	}
+	if selected >= *top+rows {
+		*top = selected - rows + 1
+	}
+}
+
+// drawTable : Directories table, return the details of the selected one
+func (t *tui) drawTable(width, rows int) []string {
+	normal := tcell.StyleDefault
+	x := 0
+	for i, column := range tuicolumns {
+		title := fmt.Sprintf("%d:%s", i+1, column.title)
+		if column.key == t.key {
+			if t.desc {
+				title = title + " ▼"
+			} else {
+				title = title + " ▲"
+			}
+		}
+		w := column.width
+		if w == 0 {
+			w = width - x
+		}
+		t.text(x, 1, w+1, normal.Bold(true).Underline(true), title)
+		x = x + w + 1
+	}
+
+	scroll(t.selected, &t.top, rows)
+	for y := 0; y < rows && t.top+y < len(t.rows); y++ {
+		e := t.rows[t.top+y]
+		style := normal
+		if e.highlight {
+			style = style.Foreground(tuicolors[e.class])
+		}
+		if t.top+y == t.selected {
+			style = style.Reverse(true)
+		}
+		x := 0
+		for _, column := range tuicolumns {
+			w := column.width
+			if w == 0 {
+				w = width - x
+			}
+			t.text(x, 2+y, w+1, style, column.value(e))
+			x = x + w + 1
+		}
+	}
+	if t.selected < len(t.rows) {
+		return t.details(t.rows[t.selected])
+	}
+	return nil
+}
+
+// drawLevel : Children of the expanded directory by decreasing size, with their percent of the parent
+func (t *tui) drawLevel(width, rows int) []string {
+	normal := tcell.StyleDefault
+	l := &t.levels[len(t.levels)-1]
+	sep := t.separator(l.path)
+	t.text(0, 1, width, normal.Bold(true).Underline(true), fmt.Sprintf("%10s %7s %-12s %9s %s", "Size", "Parent", "", "Files", "Name"))
+	scroll(l.selected, &l.top, rows)
+	for y := 0; y < rows && l.top+y < len(l.node.Children); y++ {
+		c := l.node.Children[l.top+y]
+		filled := int(c.Percent/10 + 0.5)
+		name := c.Name
+		if len(c.Children) > 0 {
+			name = name + sep
+		}
+		style := normal
+		if l.top+y == l.selected {
+			style = style.Reverse(true)
+		}
+		t.text(0, 2+y, width, style, fmt.Sprintf("%10s %6.1f%% [%s%s] %9d %s",
+			humanize.Bytes(uint64(c.Bytes)), c.Percent, strings.Repeat("#", filled), strings.Repeat(" ", 10-filled), c.Count, name))
+	}
+	if l.selected >= len(l.node.Children) {
+		return []string{"No subdirectory"}
+	}
+	c := l.node.Children[l.selected]
+	lines := []string{l.path + sep + c.Name,
+		fmt.Sprintf("%d files (%d directly) - %s - %.1f%% of %s", c.Count, c.Files, humanize.Bytes(uint64(c.Bytes)), c.Percent, humanize.Bytes(uint64(l.node.Bytes)))}
+	if c.DiskBytes > 0 {
+		lines = append(lines, fmt.Sprintf("Usage:(%s on disk)", humanize.Bytes(uint64(c.DiskBytes))))
+	}
+	if len(c.Children) > 0 {
+		lines = append(lines, fmt.Sprintf("%d subdirectories", len(c.Children)))
+	}
+	return lines
+}
+
+// details : Detail pane of a directory - class, counts, forecast, stat details and history sparklines
+func (t *tui) details(e reportEntry) []string {
+	d := e.dir
+	title := d.Path
+	if group := groupOf(t.ctx, d.Path); group != "" {
+		title = title + " - group " + group
+	}
+	lines := []string{title, fmt.Sprintf("%s%s - %d files (%+d) - %s", e.class, e.trend, d.Current.Count, e.delta, humanize.Bytes(uint64(d.Current.Bytes)))}
+	if d.Forecast != nil {
+		lines = append(lines, d.Forecast.String())
+	}
+	if len(d.Histories) > 0 {
+		counts, sizes := make([]int64, 0, len(d.Histories)+1), make([]int64, 0, len(d.Histories)+1)
+		for _, h := range d.Histories {
+			counts = append(counts, int64(h.Count))
+			sizes = append(sizes, h.Bytes)
+		}
+		counts, sizes = append(counts, int64(d.Current.Count)), append(sizes, d.Current.Bytes)
+		lines = append(lines, fmt.Sprintf("History:(files %s-size %s-%d runs)", sparkline(counts), sparkline(sizes), len(counts)))
+	}
+	return append(lines, d.Current.details()...)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// simulatedTui : tui on a simulation screen showing the entries of a finished scan
+func simulatedTui(t *testing.T, entries []reportEntry, args ...string) (*tui, tcell.SimulationScreen) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(screen.Fini)
+	screen.SetSize(100, 30)
+	ui := &tui{ctx: testContext("tui", args...), screen: screen, entries: entries, key: "path"}
+	ui.refilter()
+	return ui, screen
+}
+
+// press : Send keys, a rune or a tcell key each
+func press(t *testing.T, ui *tui, keys ...interface{}) {
+	for _, key := range keys {
+		var ev *tcell.EventKey
+		switch k := key.(type) {
+		case rune:
+			ev = tcell.NewEventKey(tcell.KeyRune, k, tcell.ModNone)
+		case tcell.Key:
+			ev = tcell.NewEventKey(k, 0, tcell.ModNone)
+		}
+		if !ui.keypressed(ev) {
+			t.Fatalf("quit on %v", key)
+		}
+	}
+}
+
+// shown : Paths of the table rows, in order
+func shown(ui *tui) []string {
+	paths := []string{}
+	for _, e := range ui.rows {
+		paths = append(paths, e.path)
+	}
+	return paths
+}
+
+// screenLine : Text of a line of the simulation screen
+func screenLine(screen tcell.SimulationScreen, y int) string {
+	cells, width, _ := screen.GetContents()
+	line := ""
+	for _, cell := range cells[y*width : (y+1)*width] {
+		line = line + string(cell.Runes)
+	}
+	return strings.TrimRight(line, " ")
+}
+
+func tuiEntries() []reportEntry {
+	entry := func(path string, count int, bytes int64) reportEntry {
+		return reportEntry{path: path, dir: Directory{Path: path, Current: Stat{Count: count, Bytes: bytes}}, class: "flat"}
+	}
+	return []reportEntry{entry("/data/a", 5, 500), entry("/data/b", 20, 100), entry("/data/in/c", 1, 1000)}
+}
+
+func TestTuiSort(t *testing.T) {
+	ui, screen := simulatedTui(t, tuiEntries())
+	tests := []struct {
+		key   rune
+		order []string
+	}{
+		{'1', []string{"/data/b", "/data/a", "/data/in/c"}}, // files, descending first
+		{'1', []string{"/data/in/c", "/data/a", "/data/b"}}, // again : reversed
+		{'r', []string{"/data/b", "/data/a", "/data/in/c"}},
+		{'3', []string{"/data/in/c", "/data/a", "/data/b"}}, // size
+		{'6', []string{"/data/a", "/data/b", "/data/in/c"}}, // path, ascending first
+	}
+	for _, test := range tests {
+		press(t, ui, test.key)
+		if !reflect.DeepEqual(shown(ui), test.order) {
+			t.Errorf("key %c: %v want %v", test.key, shown(ui), test.order)
+		}
+	}
+	// The selected directory stays selected when the order changes
+	press(t, ui, tcell.KeyDown, '3')
+	if ui.rows[ui.selected].path != "/data/b" {
+		t.Errorf("selected %s after sort", ui.rows[ui.selected].path)
+	}
+	ui.draw()
+	if header := screenLine(screen, 0); !strings.HasSuffix(header, "3/3 directories - sort size:desc") {
+		t.Errorf("header %q", header)
+	}
+}
+
+func TestTuiFilter(t *testing.T) {
+	ui, screen := simulatedTui(t, tuiEntries())
+	press(t, ui, '/', 'I', 'n')
+	if !ui.editing || !reflect.DeepEqual(shown(ui), []string{"/data/in/c"}) {
+		t.Errorf("filter while typed: %v %v", ui.editing, shown(ui))
+	}
+	// Keys are part of the filter while it is edited
+	press(t, ui, 'q', tcell.KeyBackspace2, tcell.KeyEnter)
+	if ui.editing || ui.filter != "In" || len(ui.rows) != 1 {
+		t.Errorf("filter kept: %v %q %v", ui.editing, ui.filter, shown(ui))
+	}
+	ui.draw()
+	if header, help := screenLine(screen, 0), screenLine(screen, 29); !strings.HasSuffix(header, "1/3 directories - sort path:asc - filter: In") || strings.HasPrefix(help, "filter") {
+		t.Errorf("header %q help %q", header, help)
+	}
+	press(t, ui, '/', tcell.KeyEscape)
+	if ui.filter != "" || len(ui.rows) != 3 {
+		t.Errorf("filter cleared: %q %v", ui.filter, shown(ui))
+	}
+}
+
+func TestTuiTree(t *testing.T) {
+	ui, screen := simulatedTui(t, tuiEntries(), "-tree")
+	sep := string(os.PathSeparator)
+	ui.trees = map[string]*TreeNode{"/data/a": {Name: "a", Path: "/data/a", Count: 5, Bytes: 500, Files: 1, Children: []TreeNode{
+		{Name: "x", Count: 3, Bytes: 300, Percent: 60, Children: []TreeNode{{Name: "deep", Count: 3, Bytes: 300, Percent: 100}}},
+		{Name: "y", Count: 1, Bytes: 100, Percent: 20},
+	}}}
+	steps := []struct {
+		keys []interface{}
+		path string // expanded directory, "" for the table
+	}{
+		{[]interface{}{tcell.KeyDown, tcell.KeyEnter}, ""}, // /data/b was not walked
+		{[]interface{}{tcell.KeyUp, tcell.KeyEnter}, "/data/a"},
+		{[]interface{}{'1'}, "/data/a"}, // children stay by decreasing size
+		{[]interface{}{tcell.KeyRight}, "/data/a" + sep + "x"},
+		{[]interface{}{tcell.KeyEnter}, "/data/a" + sep + "x"}, // deep has no subdirectory
+		{[]interface{}{tcell.KeyLeft}, "/data/a"},
+		{[]interface{}{tcell.KeyDown, 'l'}, "/data/a"}, // nor y
+		{[]interface{}{tcell.KeyEscape}, ""},
+	}
+	for i, step := range steps {
+		press(t, ui, step.keys...)
+		path := ""
+		if len(ui.levels) > 0 {
+			path = ui.levels[len(ui.levels)-1].path
+		}
+		if path != step.path {
+			t.Errorf("step %d: expanded %q want %q", i+1, path, step.path)
+		}
+		if i == 2 {
+			ui.draw()
+			if header := screenLine(screen, 0); !strings.Contains(header, "/data/a - 5 files (1 directly)") || ui.key != "path" {
+				t.Errorf("header %q, sort %s", header, ui.key)
+			}
+		}
+	}
+	if ui.keypressed(tcell.NewEventKey(tcell.KeyRune, 'q', tcell.ModNone)) {
+		t.Errorf("q doesn't quit")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID : Identify a file across hard links
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// fileUsage : Return file identity, allocated bytes (512 bytes blocks) and if the file has other hard links
+func fileUsage(info os.FileInfo) (fileID, int64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, info.Size(), false
+	}
+	return fileID{dev: uint64(st.Dev), ino: st.Ino}, st.Blocks * 512, st.Nlink > 1
+}
+
+// fileOwner : Owner uid and gid of a local file
+func fileOwner(info os.FileInfo) (uint32, uint32, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return st.Uid, st.Gid, true
+}
+
+// readable : Check read permission of the scanning user (ACLs and capabilities included)
+func readable(path string) bool {
+	return syscall.Access(path, 0x4) == nil // R_OK
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+)
+
+// fileID : Identify a file across hard links
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// fileUsage : Allocated size is not available, apparent size is used and hard links are not detected
+func fileUsage(info os.FileInfo) (fileID, int64, bool) {
+	return fileID{}, info.Size(), false
+}
+
+// fileOwner : Ownership is only available on Linux
+func fileOwner(info os.FileInfo) (uint32, uint32, bool) {
+	return 0, 0, false
+}
+
+// readable : Not checked, files listed are considered readable
+func readable(path string) bool {
+	return true
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Volume : Size and inodes of the filesystem holding a base, when the scan ran
+type Volume struct {
+	Total     uint64 // Bytes
+	Used      uint64
+	Free      uint64
+	Avail     uint64 // Free bytes usable by non privileged users
+	Files     uint64 // Inodes
+	FilesFree uint64
+	Scanned   time.Time
+}
+
+// volumeStater : Filesystem able to report its volume usage (local disk on Linux)
+type volumeStater interface {
+	Volume(path string) (Volume, error)
+}
+
+// recordVolume : Volume usage of a base, once per run
+func recordVolume(ctx *context, fsys FileSystem, base string) {
+	vs, ok := fsys.(volumeStater)
+	if !ok {
+		return
+	}
+	key := fsys.Prefix() + base
+	if _, ok := ctx.dirfilesout.Volumes[key]; ok {
+		return
+	}
+	v, err := vs.Volume(base)
+	if err != nil {
+		logError(ctx, fmt.Sprintf("unable to stat volume of %s: %v\n", key, err))
+		return
+	}
+	v.Scanned = ctx.starttime
+	if ctx.dirfilesout.Volumes == nil {
+		ctx.dirfilesout.Volumes = map[string]Volume{}
+	}
+	ctx.dirfilesout.Volumes[key] = v
+}
+
+// recordVolumes : Volume usage of the bases of every directory (scan, tree and refresh)
+func recordVolumes(ctx *context) {
+	for _, dir := range ctx.dirfilesout.Directories {
+		if _, ok := ctx.dirfilesout.Volumes[dir.Base]; ok {
+			continue
+		}
+		if fsys, path, err := openSource(ctx, dir.Base); err == nil {
+			recordVolume(ctx, fsys, path)
+		}
+	}
+}
+
+func (v Volume) usedRatio() float64 {
+	if v.Used+v.Avail == 0 {
+		return 0
+	}
+	// Like df, the reserved blocks are not part of the usable size
+	return 100 * float64(v.Used) / float64(v.Used+v.Avail)
+}
+
+func (v Volume) String() string {
+	return fmt.Sprintf("%s used of %s (%.0f%%), %s available, %d of %d inodes used",
+		humanize.Bytes(v.Used), humanize.Bytes(v.Total), v.usedRatio(), humanize.Bytes(v.Avail), v.Files-v.FilesFree, v.Files)
+}
+
+// volumeBases : Bases with a volume usage, sorted
+func volumeBases(ctx *context) []string {
+	bases := make([]string, 0, len(ctx.dirfilesout.Volumes))
+	for base := range ctx.dirfilesout.Volumes {
+		bases = append(bases, base)
+	}
+	sort.Strings(bases)
+	return bases
+}
+
+// reportVolumes : Summary lines, or InfluxDB lines in the <table>_volume measurement
+func reportVolumes(ctx *context) {
+	for _, base := range volumeBases(ctx) {
+		v := ctx.dirfilesout.Volumes[base]
+		if *ctx.influxdb != "" {
+			if _, err := io.WriteString(os.Stdout, fmt.Sprintf("%s_volume,base=%s total=%di,used=%di,free=%di,avail=%di,files=%di,files_free=%di\n",
+				*ctx.influxdb, strings.Replace(base, " ", "_", -1), v.Total, v.Used, v.Free, v.Avail, v.Files, v.FilesFree)); err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+		} else if !*ctx.check {
+			fmt.Printf("Volume %s : %s\n", base, v)
+		}
+	}
+}
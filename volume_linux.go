@@ -0,0 +1,20 @@
+package main
+
+import "syscall"
+
+// Volume : statfs of the filesystem holding path
+func (localFS) Volume(path string) (Volume, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return Volume{}, err
+	}
+	bsize := uint64(st.Bsize)
+	return Volume{
+		Total:     st.Blocks * bsize,
+		Used:      (st.Blocks - st.Bfree) * bsize,
+		Free:      st.Bfree * bsize,
+		Avail:     st.Bavail * bsize,
+		Files:     st.Files,
+		FilesFree: st.Ffree,
+	}, nil
+}
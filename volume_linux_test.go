@@ -0,0 +1,35 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Every base of the scan gets its volume, wildcard specs included
+func TestScanVolumes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"data/a/f.csv", "data/b/in/g.csv"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := testContext("scan", "-src", dir+"/data/*/*.csv;"+dir+"/data/in/")
+	initDataArea(ctx)
+	if genericCount(ctx) {
+		t.Fatal("scan error")
+	}
+	for _, base := range []string{dir + "/data/a/", dir + "/data/b/", dir + "/data/"} {
+		if v, ok := ctx.dirfilesout.Volumes[base]; !ok || v.Total == 0 || !v.Scanned.Equal(ctx.starttime) {
+			t.Errorf("volume of %s: %+v %v", base, v, ok)
+		}
+	}
+	if len(ctx.dirfilesout.Volumes) != 3 {
+		t.Errorf("volumes %v", volumeBases(ctx))
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// watcher : inotify watches on the cached local directories (serve -watch)
+// The files of a watched directory are kept in memory and updated by the events,
+// a refresh lists them instead of reading the directory. A queue overflow drops every list
+type watcher struct {
+	fd       int
+	lock     sync.Mutex
+	dirs     map[int]string                    // watch descriptor -> directory
+	wds      map[string]int                    // directory -> watch descriptor
+	files    map[string]map[string]os.FileInfo // directory -> name -> file, missing until read
+	pending  map[string]map[string]bool        // directory -> names changed while it is read
+	failed   map[string]bool                   // directories not watched (inotify limit...), polled
+	overflow bool
+	lost     int // overflows count, a directory read meanwhile is not kept
+}
+
+const watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_MODIFY |
+	unix.IN_ATTRIB | unix.IN_CLOSE_WRITE | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ONLYDIR
+
+func newWatcher() (*watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %v", err)
+	}
+	w := &watcher{fd: fd, dirs: map[int]string{}, wds: map[string]int{}, files: map[string]map[string]os.FileInfo{},
+		pending: map[string]map[string]bool{}, failed: map[string]bool{}}
+	go w.listen()
+	return w, nil
+}
+
+// readDir : Files of a local directory, from memory once watched
+// The watch is added before reading, so changes during the read are applied after it
+func (w *watcher) readDir(ctx *context, path string) ([]os.FileInfo, error) {
+	w.lock.Lock()
+	if index, ok := w.files[path]; ok {
+		defer w.lock.Unlock()
+		return w.list(index), nil
+	}
+	watched, lost := w.watch(ctx, path), w.lost
+	w.lock.Unlock()
+	files, err := ioutil.ReadDir(path)
+	if !watched {
+		return files, err
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	pending := w.pending[path]
+	delete(w.pending, path)
+	if err != nil {
+		return files, err
+	}
+	index := make(map[string]os.FileInfo, len(files))
+	for _, file := range files {
+		index[file.Name()] = file
+	}
+	for name := range pending {
+		w.apply(index, path, name)
+	}
+	// Events lost by an overflow during the read may concern this directory
+	if _, ok := w.wds[path]; ok && w.lost == lost {
+		w.files[path] = index
+	}
+	return w.list(index), nil
+}
+
+// watch : Add the inotify watch of a directory, false when it has to be polled
+func (w *watcher) watch(ctx *context, path string) bool {
+	if w.failed[path] {
+		return false
+	}
+	if _, ok := w.wds[path]; !ok {
+		wd, err := unix.InotifyAddWatch(w.fd, path, watchMask)
+		if err != nil {
+			w.failed[path] = true
+			logError(ctx, fmt.Sprintf("unable to watch %s, polled instead: %v\n", path, err))
+			return false
+		}
+		w.wds[path], w.dirs[wd] = wd, path
+	}
+	w.pending[path] = map[string]bool{}
+	return true
+}
+
+func (w *watcher) list(index map[string]os.FileInfo) []os.FileInfo {
+	files := make([]os.FileInfo, 0, len(index))
+	for _, file := range index {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	return files
+}
+
+// apply : Current state of one changed file
+func (w *watcher) apply(index map[string]os.FileInfo, path string, name string) {
+	if info, err := os.Lstat(filepath.Join(path, name)); err == nil {
+		index[name] = info
+	} else {
+		delete(index, name)
+	}
+}
+
+// overflowed : Events were lost since the last call, the directories are read again
+func (w *watcher) overflowed() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	overflow := w.overflow
+	w.overflow = false
+	return overflow
+}
+
+// listen : Read inotify events until the descriptor fails, then every directory is polled
+func (w *watcher) listen() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := unix.Read(w.fd, buf)
+		if err == unix.EINTR {
+			continue
+		}
+		w.lock.Lock()
+		if err != nil || n <= 0 {
+			for path := range w.wds {
+				w.failed[path] = true
+			}
+			w.files = map[string]map[string]os.FileInfo{}
+			w.lost++
+			w.lock.Unlock()
+			return
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + unix.SizeofInotifyEvent
+			offset = start + int(event.Len)
+			w.event(int(event.Wd), event.Mask, strings.TrimRight(string(buf[start:offset]), "\x00"))
+		}
+		w.lock.Unlock()
+	}
+}
+
+func (w *watcher) event(wd int, mask uint32, name string) {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		w.files = map[string]map[string]os.FileInfo{}
+		w.pending = map[string]map[string]bool{}
+		w.overflow = true
+		w.lost++
+		return
+	}
+	path, ok := w.dirs[wd]
+	if !ok {
+		return
+	}
+	switch {
+	case mask&unix.IN_IGNORED != 0:
+		// Watch removed (directory deleted or unmounted)
+		delete(w.dirs, wd)
+		delete(w.wds, path)
+		delete(w.files, path)
+	case mask&unix.IN_MOVE_SELF != 0:
+		// The watch follows the moved directory, the path is watched again by the next refresh
+		unix.InotifyRmWatch(w.fd, uint32(wd))
+		delete(w.files, path)
+	case mask&unix.IN_DELETE_SELF != 0:
+		delete(w.files, path)
+	case name != "":
+		if pending, ok := w.pending[path]; ok {
+			pending[name] = true
+		}
+		if index, ok := w.files[path]; ok {
+			w.apply(index, path, name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// watched : Wait for the in memory list of a directory to hold count files, false if it is not kept
+func watched(w *watcher, path string, count int) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		w.lock.Lock()
+		index, ok := w.files[path]
+		n := len(index)
+		w.lock.Unlock()
+		if ok && n == count {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWatchRefresh(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "in")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name string, size int) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.csv", 10)
+	write("b.csv", 20)
+	w, err := newWatcher()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer unix.Close(w.fd)
+	ctx := testContext("serve", "-watch")
+	initDataArea(ctx)
+	ctx.watcher = w
+	ctx.dirfilesout.Directories[dir] = Directory{Base: filepath.Dir(dir) + "/", Path: dir}
+	refresh := func(step string, count int, bytes int64) {
+		ctx.starttime = ctx.starttime.Add(time.Minute)
+		listCount(ctx)
+		if d := ctx.dirfilesout.Directories[dir]; d.Current.Count != count || d.Current.Bytes != bytes || d.Error != "" {
+			t.Errorf("%s: %d files %d bytes %q, want %d %d", step, d.Current.Count, d.Current.Bytes, d.Error, count, bytes)
+		}
+	}
+
+	refresh("first read", 2, 30)
+	if !watched(w, dir, 2) {
+		t.Fatal("directory not kept in memory")
+	}
+	write("c.csv", 30)
+	if !watched(w, dir, 3) {
+		t.Fatal("create event not applied")
+	}
+	refresh("created", 3, 60)
+	os.Remove(filepath.Join(dir, "a.csv"))
+	if !watched(w, dir, 2) {
+		t.Fatal("delete event not applied")
+	}
+	refresh("deleted", 2, 50)
+
+	// Queue overflow : the lists are dropped and the directory is read again
+	w.lock.Lock()
+	w.event(-1, unix.IN_Q_OVERFLOW, "")
+	_, kept := w.files[dir]
+	w.lock.Unlock()
+	if kept {
+		t.Errorf("list kept after an overflow")
+	}
+	write("d.csv", 40)
+	refresh("after overflow", 3, 90)
+	if w.overflowed() {
+		t.Errorf("overflow reported twice")
+	}
+	if !watched(w, dir, 3) {
+		t.Errorf("directory not kept again after the overflow")
+	}
+}
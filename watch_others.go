@@ -0,0 +1,24 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+// watcher : inotify is only available on Linux, -watch is refused elsewhere
+type watcher struct{}
+
+func newWatcher() (*watcher, error) {
+	return nil, errors.New("-watch needs inotify (Linux)")
+}
+
+func (w *watcher) readDir(ctx *context, path string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(path)
+}
+
+func (w *watcher) overflowed() bool {
+	return false
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// expandSpec : One spec per directory matching the wildcards before the last element
+// * and ? match one directory name, ** any depth (none included). Recursive is true with **
+func expandSpec(ctx *context, fsys FileSystem, spec string) ([]string, bool, error) {
+	sep := fsys.Separator()
+	trailing := strings.HasSuffix(spec, sep)
+	dirname, last := splitPattern(fsys, strings.TrimSuffix(spec, sep))
+	segments := strings.Split(strings.TrimSuffix(dirname, sep), sep)
+	first := -1
+	for i, segment := range segments {
+		if isWildcard(segment) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return []string{spec}, false, nil
+	}
+	if trailing {
+		last = last + sep
+	}
+	specs := []string{}
+	seen := map[string]bool{}
+	root := ""
+	if first > 0 {
+		root = strings.Join(segments[:first], sep) + sep
+	}
+	err := expandDirs(ctx, fsys, root, segments[first:], func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			specs = append(specs, dir+last)
+		}
+	})
+	return specs, contains(segments[first:], "**"), err
+}
+
+// expandDirs : Call fn with each directory (ending with the separator) matching the segments under root
+// Only root ("" for the current directory) has to exist, missing or unreadable directories below are skipped (logged)
+func expandDirs(ctx *context, fsys FileSystem, root string, segments []string, fn func(string)) error {
+	if len(segments) == 0 {
+		fn(root)
+		return nil
+	}
+	sep := fsys.Separator()
+	segment := segments[0]
+	if !isWildcard(segment) {
+		if info, err := fsys.Stat(root + segment); err == nil && info.IsDir() {
+			return expandDirs(ctx, fsys, root+segment+sep, segments[1:], fn)
+		}
+		return nil
+	}
+	if segment == "**" {
+		if err := expandDirs(ctx, fsys, root, segments[1:], fn); err != nil {
+			return err
+		}
+	}
+	dirname := root
+	if dirname == "" {
+		dirname = "."
+	}
+	files, err := fsys.ReadDir(dirname)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		next := segments[1:]
+		if segment == "**" {
+			next = segments
+		} else if !matchPattern(segment, file.Name()) {
+			continue
+		}
+		if err := expandDirs(ctx, fsys, root+file.Name()+sep, next, fn); err != nil {
+			logError(ctx, fmt.Sprintf("Process error: %v\n", err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func wildcardFS() *memFS {
+	fsys := newMemFS("mem://")
+	for _, name := range []string{"/data/in", "/data/a/in", "/data/a/b/in", "/data/a/b/out", "/data/c/out", "/data/cd/in"} {
+		fsys.add(name, memInfo{mode: os.ModeDir | 0555})
+	}
+	fsys.add("/data/a/b/in/f.csv", memInfo{size: 10})
+	return fsys
+}
+
+func TestExpandSpec(t *testing.T) {
+	ctx := testContext("scan")
+	fsys := wildcardFS()
+	tests := []struct {
+		spec      string
+		specs     []string
+		recursive bool
+	}{
+		{"/data/in/*.csv", []string{"/data/in/*.csv"}, false},
+		// The looked for name is searched by the walk of each base, not expanded
+		{"/data/*/in/", []string{"/data/a/in/", "/data/c/in/", "/data/cd/in/", "/data/in/in/"}, false},
+		{"/data/c?/*.csv", []string{"/data/cd/*.csv"}, false},
+		{"/data/**/*.csv", []string{"/data/*.csv", "/data/a/*.csv", "/data/a/b/*.csv", "/data/a/b/in/*.csv", "/data/a/b/out/*.csv",
+			"/data/a/in/*.csv", "/data/c/*.csv", "/data/c/out/*.csv", "/data/cd/*.csv", "/data/cd/in/*.csv", "/data/in/*.csv"}, true},
+		{"/data/**/b/*", []string{"/data/a/b/*"}, true},
+	}
+	for _, test := range tests {
+		specs, recursive, err := expandSpec(ctx, fsys, test.spec)
+		if err != nil {
+			t.Errorf("%s: %v", test.spec, err)
+			continue
+		}
+		sort.Strings(specs)
+		if !reflect.DeepEqual(specs, test.specs) || recursive != test.recursive {
+			t.Errorf("%s: %v %v want %v %v", test.spec, specs, recursive, test.specs, test.recursive)
+		}
+	}
+	if _, _, err := expandSpec(ctx, fsys, "/data/missing/*/in/"); err == nil {
+		t.Errorf("missing root directory expanded")
+	}
+}
+
+// data/**/in/ gives a base per directory, only data/ is walked
+func TestDropNested(t *testing.T) {
+	ctx := testContext("scan")
+	fsys := wildcardFS()
+	specs, recursive, err := expandSpec(ctx, fsys, "/data/**/in/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := map[string]*walkSpec{}
+	for _, spec := range specs {
+		addSpec(ctx, fsys, spec, recursive, dir)
+	}
+	dir["mem:///data/a/"].look += ";out"
+	dir["mem:///other/"] = &walkSpec{fsys: fsys, base: "/other/", look: "in"}
+	dropNested(dir)
+	bases := []string{}
+	for p := range dir {
+		bases = append(bases, p)
+	}
+	sort.Strings(bases)
+	// a/ also looks for out directories, not walked by data/
+	if want := []string{"mem:///data/", "mem:///data/a/", "mem:///other/"}; !reflect.DeepEqual(bases, want) {
+		t.Errorf("walked bases %v want %v", bases, want)
+	}
+}